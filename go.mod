@@ -13,6 +13,7 @@ require (
 	go.minekube.com/common v0.3.0
 	go.minekube.com/gate v0.57.1
 	google.golang.org/api v0.247.0
+	google.golang.org/protobuf v1.36.10
 )
 
 require (
@@ -105,6 +106,5 @@ require (
 	google.golang.org/genproto/googleapis/api v0.0.0-20251007200510-49b9836ed3ff // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20251007200510-49b9836ed3ff // indirect
 	google.golang.org/grpc v1.76.0 // indirect
-	google.golang.org/protobuf v1.36.10 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
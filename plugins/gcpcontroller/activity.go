@@ -0,0 +1,163 @@
+package gcpcontroller
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Supported values for activityStatus.target
+const (
+	activityTargetLabels   = "labels"
+	activityTargetMetadata = "metadata"
+)
+
+// labelKeyPattern matches the label key prefixes GCE accepts
+var labelKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// managedByValue identifies this plugin in the managed-by label or metadata item
+const managedByValue = "gate-gcp-controller"
+
+// ActivityStatusConfig configures writing the activity of the managed server onto its instance,
+// so other tooling can tell whether the VM is idle
+type ActivityStatusConfig struct {
+	Enabled bool
+	// Target is where the status is written: labels or metadata
+	Target string
+	// Prefix is prepended to every label or metadata key
+	Prefix string
+	// MinIntervalSeconds is the minimum time between two writes to the instance
+	MinIntervalSeconds int
+}
+
+// notifyActivity makes the activity writer update the instance soon
+func (g *gcpController) notifyActivity() {
+	if g.activityChanged == nil {
+		return
+	}
+	select {
+	case g.activityChanged <- struct{}{}:
+	default:
+	}
+}
+
+// nextShutdown returns when the instance is going to be stopped by the idle or safety timer,
+// or the zero time if no shutdown is scheduled. Must be called with g.mu held.
+func (g *gcpController) nextShutdown() time.Time {
+	var next time.Time
+	for _, at := range []time.Time{g.shutdownAt, g.safetyShutdownAt} {
+		if at.After(time.Now()) && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	return next
+}
+
+// activityStatus returns the labels or metadata items describing the current activity
+// and the instance they belong to
+func (g *gcpController) activityStatus(ctx context.Context) (InstanceConfig, map[string]string) {
+	g.mu.RLock()
+	inst := g.config.instances()[g.activeInstance]
+	players := g.playerCount
+	lastActivity := g.lastActivity
+	shutdownAt := g.nextShutdown()
+	g.mu.RUnlock()
+
+	// Include players connected through other proxy replicas
+	if g.coordinator != nil {
+		remote, err := g.coordinator.remoteActivity(ctx, g.config.ServerAddress)
+		if err != nil {
+			g.log.Error(err, "Failed to read player counts of other proxy replicas")
+		}
+		players += remote.Players
+	}
+
+	// Label values may only contain lowercase letters, digits, '-' and '_',
+	// so times are written as Unix seconds there
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return "none"
+		}
+		if g.config.ActivityStatus.Target == activityTargetLabels {
+			return strconv.FormatInt(t.Unix(), 10)
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+
+	prefix := g.config.ActivityStatus.Prefix
+	return inst, map[string]string{
+		prefix + "managed-by":         managedByValue,
+		prefix + "last-activity":      formatTime(lastActivity),
+		prefix + "player-count":       strconv.Itoa(players),
+		prefix + "scheduled-shutdown": formatTime(shutdownAt),
+	}
+}
+
+// writeActivityStatus keeps the activity status of the instance up to date until ctx is done.
+// Changes are written at most once per minIntervalSeconds, and only if the values changed.
+func (g *gcpController) writeActivityStatus(ctx context.Context) {
+	interval := time.Duration(g.config.ActivityStatus.MinIntervalSeconds) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var (
+		written     map[string]string
+		writtenTo   InstanceConfig
+		lastWriteAt time.Time
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-g.activityChanged:
+		case <-ticker.C:
+		}
+
+		// Rate limit writes, later changes are picked up by the same write
+		if wait := interval - time.Since(lastWriteAt); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+
+		writeCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		inst, status := g.activityStatus(writeCtx)
+		if inst == writtenTo && maps.Equal(status, written) {
+			cancel()
+			continue
+		}
+
+		var err error
+		if g.config.ActivityStatus.Target == activityTargetLabels {
+			err = g.provider.SetLabels(writeCtx, inst, status)
+		} else {
+			err = g.provider.SetMetadata(writeCtx, inst, status)
+		}
+		cancel()
+		lastWriteAt = time.Now()
+
+		if errors.Is(err, errNoGroupMember) {
+			// The group was scaled to 0, the status is written once it has an instance again
+			g.log.V(1).Info("Instance group has no instance, skipping activity status",
+				"instanceGroup", inst.InstanceGroup)
+			continue
+		}
+		if err != nil {
+			// Retried on the next tick
+			g.log.Error(err, "Failed to write activity status to instance",
+				"instance", inst.name(),
+				"target", g.config.ActivityStatus.Target)
+			continue
+		}
+		written, writtenTo = status, inst
+
+		g.log.V(1).Info("Wrote activity status to instance",
+			"instance", inst.name(),
+			"status", status)
+	}
+}
@@ -0,0 +1,35 @@
+package gcpcontroller
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWriteActivityStatusLabels(t *testing.T) {
+	g, fake := newTestController(t, statusRunning, func(c *Config) {
+		c.ActivityStatus = ActivityStatusConfig{
+			Enabled:            true,
+			Target:             activityTargetLabels,
+			Prefix:             "gate-",
+			MinIntervalSeconds: 1,
+		}
+	})
+	g.activityChanged = make(chan struct{}, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go g.writeActivityStatus(ctx)
+
+	g.mu.Lock()
+	g.playerCount = 2
+	g.notifyActivity()
+	g.mu.Unlock()
+
+	waitFor(t, "activity labels", func() bool {
+		return fake.Labels(testProject, testZone, testInstance)["gate-player-count"] == "2"
+	})
+	labels := fake.Labels(testProject, testZone, testInstance)
+	if labels["gate-managed-by"] != managedByValue || labels["gate-scheduled-shutdown"] != "none" {
+		t.Errorf("labels = %v, want managed-by %s and no scheduled shutdown", labels, managedByValue)
+	}
+}
@@ -0,0 +1,124 @@
+package gcpcontroller
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// APIConfig configures the HTTP API serving the information of the /gcp commands as JSON
+type APIConfig struct {
+	Enabled bool
+	// Bind is the address the API listens on
+	Bind string
+	// Token is required as bearer token on every request if set
+	Token string
+}
+
+// serveAPI serves the HTTP API until ctx is done
+func (g *gcpController) serveAPI(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /report", g.handleReport)
+	mux.HandleFunc("GET /console", g.handleConsole)
+
+	server := &http.Server{
+		Addr:              g.config.API.Bind,
+		Handler:           g.authenticateAPI(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	g.log.Info("Serving HTTP API", "bind", g.config.API.Bind)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		g.log.Error(err, "HTTP API stopped")
+	}
+}
+
+// authenticateAPI rejects requests without the configured bearer token
+func (g *gcpController) authenticateAPI(next http.Handler) http.Handler {
+	if g.config.API.Token == "" {
+		return next
+	}
+	expected := []byte("Bearer " + g.config.API.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			writeAPIError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleReport serves the cost report of /gcp report. The period is given as query parameter,
+// e.g. /report?period=30d.
+func (g *gcpController) handleReport(w http.ResponseWriter, r *http.Request) {
+	period, err := parseReportPeriod(r.URL.Query().Get("period"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := g.report(period)
+	if err != nil {
+		g.log.Error(err, "Failed to read audit log")
+		writeAPIError(w, http.StatusInternalServerError, "failed to read the lifecycle history")
+		return
+	}
+	writeAPIResponse(w, report)
+}
+
+// handleConsole serves the serial console output of /gcp console. The number of lines and the
+// managed server are given as query parameters, e.g. /console?lines=100&server=server2.
+func (g *gcpController) handleConsole(w http.ResponseWriter, r *http.Request) {
+	lines := defaultConsoleLines
+	if param := r.URL.Query().Get("lines"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > maxConsoleLines {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("lines must be between 1 and %d", maxConsoleLines))
+			return
+		}
+		lines = n
+	}
+
+	controller := g
+	if name := r.URL.Query().Get("server"); name != "" {
+		var err error
+		if controller, err = g.managedServer(name); err != nil {
+			writeAPIError(w, http.StatusNotFound, err.Error())
+			return
+		}
+	}
+
+	output, err := controller.console(r.Context(), lines)
+	if err != nil {
+		controller.log.Error(err, "Failed to read serial console output")
+		writeAPIError(w, http.StatusBadGateway, "failed to read the serial console output")
+		return
+	}
+	writeAPIResponse(w, output)
+}
+
+// writeAPIResponse writes v as JSON
+func writeAPIResponse(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// writeAPIError writes an error as JSON
+func writeAPIError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
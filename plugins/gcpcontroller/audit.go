@@ -0,0 +1,146 @@
+package gcpcontroller
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Lifecycle events written to the audit log
+const (
+	auditStartRequested    = "start_requested"
+	auditStartSucceeded    = "start_succeeded"
+	auditStartFailed       = "start_failed"
+	auditFirstJoin         = "first_join"
+	auditShutdownScheduled = "shutdown_scheduled"
+	auditShutdownCancelled = "shutdown_cancelled"
+	auditShutdownExtended  = "shutdown_extended"
+	auditStop              = "stop"
+	auditSafetyShutdown    = "safety_shutdown"
+	auditStopFailed        = "stop_failed"
+	auditWatchdogRecovered = "watchdog_recovered"
+	auditWatchdogFailed    = "watchdog_failed"
+)
+
+// trigger describes who or what caused a lifecycle action
+type trigger struct {
+	Player   string // username of the triggering player, empty if not caused by a player
+	PlayerID string // UUID of the triggering player
+	Reason   string // e.g. player_connect, idle_timeout
+	Profile  string // start profile requested by the trigger, empty for the server's default
+}
+
+// auditRecord is a single entry of the audit log
+type auditRecord struct {
+	Time         time.Time `json:"time"`
+	Event        string    `json:"event"`
+	Player       string    `json:"player,omitempty"`
+	PlayerID     string    `json:"playerId,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+	Profile      string    `json:"profile,omitempty"`
+	Server       string    `json:"server,omitempty"`
+	Instance     string    `json:"instance,omitempty"`
+	Zone         string    `json:"zone,omitempty"`
+	StatusBefore string    `json:"statusBefore,omitempty"`
+	StatusAfter  string    `json:"statusAfter,omitempty"`
+	// DurationSeconds is the duration of the start/stop operation, or the
+	// timeout of a scheduled shutdown
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+	// UptimeSeconds is how long the instance ran before it was stopped
+	UptimeSeconds float64 `json:"uptimeSeconds,omitempty"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// auditLog appends lifecycle records to a JSON Lines file
+type auditLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+// append writes a record to the end of the audit log
+func (a *auditLog) append(rec auditRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(a.path), 0755); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	f, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	return nil
+}
+
+// recent returns the last n records of the audit log, oldest first
+func (a *auditLog) recent(n int) ([]auditRecord, error) {
+	records, err := a.all()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > n {
+		records = records[len(records)-n:]
+	}
+	return records, nil
+}
+
+// all returns all records of the audit log, oldest first. Lines that can't be parsed are skipped.
+func (a *auditLog) all() ([]auditRecord, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, err := os.Open(a.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	return records, nil
+}
+
+// audit appends a record to the audit log, filling in the time and the triggering player
+func (g *gcpController) audit(event string, tr trigger, rec auditRecord) {
+	rec.Time = time.Now()
+	rec.Event = event
+	rec.Player = tr.Player
+	rec.PlayerID = tr.PlayerID
+	rec.Reason = tr.Reason
+	rec.Profile = tr.Profile
+	rec.Server = g.config.ServerAddress
+
+	if err := g.auditLog.append(rec); err != nil {
+		g.log.Error(err, "Failed to write audit log", "event", event)
+	}
+}
@@ -0,0 +1,207 @@
+package gcpcontroller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/option"
+)
+
+// permissionCheckTimeout is how long the permission self-check may take
+const permissionCheckTimeout = 30 * time.Second
+
+// cloudPlatformScope is the OAuth scope requested for impersonated credentials
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// AuthConfig configures how the plugin authenticates against the Compute Engine API
+type AuthConfig struct {
+	// CredentialsEnv is the name of an environment variable holding service account JSON
+	// credentials, instead of credentialsPath
+	CredentialsEnv string
+	// ImpersonateServiceAccount is the email of a service account whose permissions are used,
+	// with the credentials acting as it
+	ImpersonateServiceAccount string
+	// Delegates is the chain of service accounts to impersonate the service account through
+	Delegates []string
+	// QuotaProject is the project billed for the API quota instead of the credentials' project
+	QuotaProject string
+	// Endpoint replaces the Compute Engine API endpoint, e.g. an emulator or Private Service Connect
+	Endpoint string
+	// WithoutAuthentication sends requests without credentials, e.g. to an emulator
+	WithoutAuthentication bool
+	// SelfCheck verifies the permissions on the instances when the plugin starts
+	SelfCheck bool
+}
+
+// validate checks the auth settings against each other and the top-level credentialsPath
+func (c AuthConfig) validate(credentialsPath string) error {
+	if c.CredentialsEnv != "" {
+		if credentialsPath != "" {
+			return fmt.Errorf("gcpController.auth.credentialsEnv and gcpController.credentialsPath can't both be set")
+		}
+		if os.Getenv(c.CredentialsEnv) == "" {
+			return fmt.Errorf("gcpController.auth.credentialsEnv: environment variable %s is not set", c.CredentialsEnv)
+		}
+	}
+	if c.WithoutAuthentication && (credentialsPath != "" || c.CredentialsEnv != "" || c.ImpersonateServiceAccount != "") {
+		return fmt.Errorf("gcpController.auth.withoutAuthentication can't be combined with credentials or impersonation")
+	}
+	if len(c.Delegates) > 0 && c.ImpersonateServiceAccount == "" {
+		return fmt.Errorf("gcpController.auth.delegates requires impersonateServiceAccount")
+	}
+	return nil
+}
+
+// clientOptions returns the options of the Compute Engine clients for the configured credentials,
+// impersonation, quota project and endpoint
+func clientOptions(ctx context.Context, config *Config) ([]option.ClientOption, error) {
+	opts, err := credentialOptions(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if config.Auth.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(config.Auth.Endpoint))
+	}
+	return opts, nil
+}
+
+// credentialOptions returns the client options for the configured credentials, impersonation and
+// quota project, which apply to all Google APIs the plugin uses
+func credentialOptions(ctx context.Context, config *Config) ([]option.ClientOption, error) {
+	auth := config.Auth
+
+	// Credentials of the plugin itself, Application Default Credentials if none are set
+	var credentials []option.ClientOption
+	switch {
+	case auth.WithoutAuthentication:
+		credentials = append(credentials, option.WithoutAuthentication())
+	case config.CredentialsPath != "":
+		credentials = append(credentials, option.WithCredentialsFile(config.CredentialsPath))
+	case auth.CredentialsEnv != "":
+		credentials = append(credentials, option.WithCredentialsJSON([]byte(os.Getenv(auth.CredentialsEnv))))
+	}
+
+	opts := credentials
+	if auth.ImpersonateServiceAccount != "" {
+		tokens, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+			TargetPrincipal: auth.ImpersonateServiceAccount,
+			Delegates:       auth.Delegates,
+			Scopes:          []string{cloudPlatformScope},
+		}, credentials...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to impersonate service account %s: %w", auth.ImpersonateServiceAccount, err)
+		}
+		opts = []option.ClientOption{option.WithTokenSource(tokens)}
+	}
+	if auth.QuotaProject != "" {
+		opts = append(opts, option.WithQuotaProject(auth.QuotaProject))
+	}
+	return opts, nil
+}
+
+// permissionCheck is a permission on an instance the plugin may use
+type permissionCheck struct {
+	permission string
+	// feature needs the permission, empty if every server does
+	feature string
+}
+
+// requiredPermissions returns the permissions on the instances of a managed server the configuration needs
+func requiredPermissions(config *Config) []permissionCheck {
+	checks := []permissionCheck{
+		{permission: "compute.instances.get"},
+		{permission: "compute.instances.start"},
+		{permission: "compute.instances.stop"},
+	}
+	if config.Readiness.Source == readinessGuestAttribute {
+		checks = append(checks, permissionCheck{"compute.instances.getGuestAttributes", "readiness.source: guestAttribute"})
+	}
+	if config.Readiness.Source == readinessMetadata {
+		checks = append(checks, permissionCheck{"compute.instances.setMetadata", "readiness.source: metadata"})
+	}
+	if config.ActivityStatus.Enabled && config.ActivityStatus.Target == activityTargetLabels {
+		checks = append(checks, permissionCheck{"compute.instances.setLabels", "activityStatus"})
+	}
+	if config.ActivityStatus.Enabled && config.ActivityStatus.Target == activityTargetMetadata {
+		checks = append(checks, permissionCheck{"compute.instances.setMetadata", "activityStatus"})
+	}
+	if len(config.StartProfiles) > 0 {
+		checks = append(checks, permissionCheck{"compute.instances.setMetadata", "startProfiles"})
+	}
+	if config.Watchdog.Enabled && config.Watchdog.Action == watchdogReset {
+		checks = append(checks, permissionCheck{"compute.instances.reset", "watchdog"})
+	}
+	if config.Console.CaptureLines > 0 {
+		checks = append(checks, permissionCheck{"compute.instances.getSerialPortOutput", "console.captureLines"})
+	}
+	return checks
+}
+
+// checkPermissions tests whether the credentials have the permissions the configuration needs on
+// every instance, and logs the missing ones. It doesn't prevent the plugin from starting, as the
+// permissions may be granted later.
+func checkPermissions(ctx context.Context, provider instanceProvider, config *Config, log logr.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, permissionCheckTimeout)
+	defer cancel()
+
+	for _, server := range config.servers() {
+		checks := requiredPermissions(server)
+		var permissions []string
+		for _, check := range checks {
+			if !slices.Contains(permissions, check.permission) {
+				permissions = append(permissions, check.permission)
+			}
+		}
+
+		for _, inst := range server.instances() {
+			if inst.InstanceGroup != "" {
+				// The instance of a group only exists while it runs
+				log.V(1).Info("Skipping permission check of instance group", "instanceGroup", inst.InstanceGroup)
+				continue
+			}
+
+			missing, err := provider.MissingPermissions(ctx, inst, permissions)
+			if err != nil {
+				log.Error(err, "Failed to check GCP permissions", "instance", inst.name())
+				continue
+			}
+			if len(missing) == 0 {
+				log.V(1).Info("GCP permissions verified", "instance", inst.name())
+				continue
+			}
+
+			var required []string
+			features := make(map[string][]string)
+			for _, check := range checks {
+				if !slices.Contains(missing, check.permission) {
+					continue
+				}
+				if check.feature == "" {
+					required = append(required, check.permission)
+				} else {
+					features[check.permission] = append(features[check.permission], check.feature)
+				}
+			}
+			if len(required) > 0 {
+				log.Error(nil, "GCP credentials are missing permissions, the instance can't be managed",
+					"instance", inst.name(),
+					"zone", inst.Zone,
+					"missing", strings.Join(required, ", "))
+			}
+			for _, permission := range slices.Sorted(maps.Keys(features)) {
+				log.Info("GCP credentials are missing a permission, some features won't work",
+					"instance", inst.name(),
+					"zone", inst.Zone,
+					"missing", permission,
+					"neededBy", strings.Join(features[permission], ", "))
+			}
+		}
+	}
+}
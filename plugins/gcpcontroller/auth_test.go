@@ -0,0 +1,63 @@
+package gcpcontroller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+)
+
+func TestCheckPermissions(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, func(c *Config) {
+		c.Watchdog = WatchdogConfig{Enabled: true, Action: watchdogReset}
+	})
+	fake.DenyPermissions("compute.instances.stop", "compute.instances.reset")
+
+	missing, err := g.provider.MissingPermissions(context.Background(), g.config.primaryInstance(),
+		[]string{"compute.instances.get", "compute.instances.stop"})
+	if err != nil || len(missing) != 1 || missing[0] != "compute.instances.stop" {
+		t.Fatalf("MissingPermissions = %v, %v, want compute.instances.stop", missing, err)
+	}
+
+	var logs []string
+	log := funcr.New(func(prefix, args string) {
+		logs = append(logs, args)
+	}, funcr.Options{})
+	checkPermissions(context.Background(), g.provider, g.config, log)
+
+	output := strings.Join(logs, "\n")
+	for _, expected := range []string{
+		`"instance"="minecraft" "zone"="europe-west1-b" "missing"="compute.instances.stop"`,
+		`"missing"="compute.instances.reset" "neededBy"="watchdog"`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("log doesn't contain %s:\n%s", expected, output)
+		}
+	}
+}
+
+func TestAuthValidation(t *testing.T) {
+	t.Setenv("TEST_GCP_CREDENTIALS", `{"type":"service_account"}`)
+
+	tests := []struct {
+		name            string
+		config          AuthConfig
+		credentialsPath string
+		valid           bool
+	}{
+		{"defaults", AuthConfig{SelfCheck: true}, "", true},
+		{"credentials env", AuthConfig{CredentialsEnv: "TEST_GCP_CREDENTIALS"}, "", true},
+		{"credentials env and path", AuthConfig{CredentialsEnv: "TEST_GCP_CREDENTIALS"}, "/key.json", false},
+		{"unset credentials env", AuthConfig{CredentialsEnv: "TEST_GCP_UNSET"}, "", false},
+		{"emulator", AuthConfig{Endpoint: "http://localhost:8080", WithoutAuthentication: true}, "", true},
+		{"emulator with credentials", AuthConfig{WithoutAuthentication: true}, "/key.json", false},
+		{"delegates without impersonation", AuthConfig{Delegates: []string{"a@p.iam.gserviceaccount.com"}}, "", false},
+	}
+	for _, tt := range tests {
+		err := tt.config.validate(tt.credentialsPath)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: validate() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
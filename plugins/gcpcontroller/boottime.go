@@ -0,0 +1,233 @@
+package gcpcontroller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bootWatchTimeout is how long to wait for the server to become ready after a start
+const bootWatchTimeout = 20 * time.Minute
+
+// bootRecord is a measured boot of the managed server
+type bootRecord struct {
+	StartedAt time.Time `json:"startedAt"`
+	Seconds   float64   `json:"seconds"`
+}
+
+// bootHistory keeps the most recent boot durations to estimate how long the next boot takes
+type bootHistory struct {
+	path     string
+	size     int
+	fallback time.Duration
+
+	mu      sync.Mutex
+	records []bootRecord
+}
+
+// newBootHistory creates a boot history stored at path keeping the last size boots.
+// fallback is the estimate used until the first boot has been measured.
+func newBootHistory(path string, size int, fallback time.Duration) *bootHistory {
+	return &bootHistory{
+		path:     path,
+		size:     size,
+		fallback: fallback,
+	}
+}
+
+// load loads the boot history from file
+func (h *bootHistory) load() error {
+	data, err := os.ReadFile(h.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read boot history file: %w", err)
+	}
+
+	var records []bootRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("failed to parse boot history file: %w", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = records
+	h.trim()
+
+	return nil
+}
+
+// add records a boot and saves the history to file
+func (h *bootHistory) add(startedAt time.Time, duration time.Duration) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.records = append(h.records, bootRecord{
+		StartedAt: startedAt,
+		Seconds:   duration.Seconds(),
+	})
+	h.trim()
+
+	data, err := json.MarshalIndent(h.records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal boot history: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	if err := os.WriteFile(h.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write boot history file: %w", err)
+	}
+
+	return nil
+}
+
+// trim drops the oldest records beyond the history size. Must be called with h.mu held.
+func (h *bootHistory) trim() {
+	if len(h.records) > h.size {
+		h.records = h.records[len(h.records)-h.size:]
+	}
+}
+
+// estimate returns the average of the recorded boot durations
+func (h *bootHistory) estimate() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.records) == 0 {
+		return h.fallback
+	}
+
+	var total float64
+	for _, r := range h.records {
+		total += r.Seconds
+	}
+	return time.Duration(total / float64(len(h.records)) * float64(time.Second))
+}
+
+// formatDuration formats a duration for players, e.g. "45s" or "3m 40s"
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+
+	minutes := int(d.Minutes())
+	seconds := int(d.Seconds()) % 60
+	if seconds == 0 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dm %ds", minutes, seconds)
+}
+
+// bootETA returns the expected remaining boot time. Must be called with g.mu held.
+func (g *gcpController) bootETA() time.Duration {
+	estimate := g.bootHistory.estimate()
+	if !g.isStarting {
+		return estimate
+	}
+	return max(estimate-time.Since(g.bootStartedAt), 0)
+}
+
+// applyPlaceholders replaces the boot placeholders in a player-facing message:
+// {eta} is the expected remaining boot time and {elapsed} the time since the start was requested.
+func (g *gcpController) applyPlaceholders(msg string) string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	var elapsed time.Duration
+	if g.isStarting {
+		elapsed = time.Since(g.bootStartedAt)
+	}
+
+	remaining := g.bootETA()
+	eta := formatDuration(remaining)
+	if g.isStarting && remaining < 5*time.Second {
+		eta = "a few seconds"
+	}
+
+	return strings.NewReplacer(
+		"{eta}", eta,
+		"{elapsed}", formatDuration(elapsed),
+	).Replace(msg)
+}
+
+// watchBoot waits for the server to become ready after a start and records how long the boot took
+func (g *gcpController) watchBoot(startedAt time.Time) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	deadline := time.After(bootWatchTimeout)
+	for {
+		select {
+		case <-ticker.C:
+			// Stop watching a boot that ended or was replaced, e.g. by a stop and a new start
+			g.mu.RLock()
+			stale := !g.isStarting || !g.bootStartedAt.Equal(startedAt)
+			g.mu.RUnlock()
+			if stale {
+				return
+			}
+
+			g.retryPendingRoute()
+			server := g.proxy.Server(g.config.ServerAddress)
+			if server == nil || !g.probeReady(server) {
+				if recovered := g.watchdog(startedAt); !recovered.Equal(startedAt) {
+					// Watch the boot after the recovery from scratch
+					startedAt = recovered
+					deadline = time.After(bootWatchTimeout)
+				}
+				continue
+			}
+			g.markReady(startedAt)
+			return
+		case <-deadline:
+			g.mu.RLock()
+			stale := !g.isStarting || !g.bootStartedAt.Equal(startedAt)
+			g.mu.RUnlock()
+			if stale {
+				return
+			}
+			g.log.Info("Server did not become ready after start, not recording boot time",
+				"timeout", bootWatchTimeout)
+			g.captureConsole("boot_timeout")
+			return
+		}
+	}
+}
+
+// markReady records the boot time of the start requested at startedAt
+func (g *gcpController) markReady(startedAt time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Ignore stale watchers, e.g. when the server was stopped and started again meanwhile
+	if !g.isStarting || !g.bootStartedAt.Equal(startedAt) {
+		return
+	}
+	g.isStarting = false
+	clear(g.waitingPlayers)
+
+	duration := time.Since(startedAt)
+	if err := g.bootHistory.add(startedAt, duration); err != nil {
+		g.log.Error(err, "Failed to save boot history")
+	}
+
+	g.log.Info("Server is ready",
+		"bootTime", duration.Round(time.Second),
+		"estimate", g.bootHistory.estimate().Round(time.Second))
+
+	go g.runHooks(context.Background(), hookAfterReady, hookEvent{
+		instance: g.config.instances()[g.activeInstance],
+		trigger:  trigger{Reason: "server_ready"},
+		status:   g.lastStatus,
+		duration: duration,
+	})
+}
@@ -0,0 +1,449 @@
+package gcpcontroller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	c "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// defaultHistoryEntries is the number of audit log entries shown by /gcp history
+const defaultHistoryEntries = 10
+
+// isOperator checks if a player UUID is in the operators list
+func (g *gcpController) isOperator(uuid string) bool {
+	return slices.Contains(g.config.Operators, uuid)
+}
+
+// operatorCommand wraps a command that may only be executed by operators
+func (g *gcpController) operatorCommand(fn func(ctx *command.Context, player proxy.Player) error) brigodier.Command {
+	return command.Command(func(ctx *command.Context) error {
+		// Check if source is a player
+		player, ok := ctx.Source.(proxy.Player)
+		if !ok {
+			return ctx.Source.SendMessage(&c.Text{
+				Content: "This command can only be executed by players.",
+				S:       c.Style{Color: color.Red},
+			})
+		}
+
+		// Check if player is an operator
+		if !g.isOperator(player.ID().String()) {
+			return player.SendMessage(&c.Text{
+				Content: "You're not permitted to use this command.",
+				S:       c.Style{Color: color.Red},
+			})
+		}
+
+		return fn(ctx, player)
+	})
+}
+
+// gcpCommand creates the /gcp command
+func (g *gcpController) gcpCommand() brigodier.LiteralNodeBuilder {
+	return brigodier.Literal("gcp").
+		Then(g.gcpHistoryCommand()).
+		Then(g.gcpReportCommand()).
+		Then(g.gcpFlagCommand()).
+		Then(g.gcpStartCommand()).
+		Then(g.gcpConsoleCommand())
+}
+
+// controllerOf returns the controller of the managed server a player is on, or nil
+func (g *gcpController) controllerOf(player proxy.Player) *gcpController {
+	conn := player.CurrentServer()
+	if conn == nil {
+		return nil
+	}
+	name := conn.Server().ServerInfo().Name()
+	for _, controller := range g.servers {
+		if controller.config.ServerAddress == name {
+			return controller
+		}
+	}
+	return nil
+}
+
+// gcpHistoryCommand creates the /gcp history subcommand
+func (g *gcpController) gcpHistoryCommand() brigodier.LiteralNodeBuilder {
+	showHistory := g.operatorCommand(func(ctx *command.Context, player proxy.Player) error {
+		count := defaultHistoryEntries
+		if n := ctx.Int("count"); n > 0 {
+			count = n
+		}
+
+		records, err := g.auditLog.recent(count)
+		if err != nil {
+			g.log.Error(err, "Failed to read audit log")
+			return player.SendMessage(&c.Text{
+				Content: "Failed to read the lifecycle history.",
+				S:       c.Style{Color: color.Red},
+			})
+		}
+
+		if len(records) == 0 {
+			return player.SendMessage(&c.Text{
+				Content: "The lifecycle history is empty.",
+				S:       c.Style{Color: color.Yellow},
+			})
+		}
+
+		// Build response
+		header := &c.Text{
+			Content: fmt.Sprintf("Lifecycle history (last %d):", len(records)),
+			S:       c.Style{Color: color.Gold, Bold: c.True},
+		}
+
+		message := &c.Text{}
+		message.Extra = []c.Component{header}
+
+		for _, rec := range records {
+			message.Extra = append(message.Extra,
+				&c.Text{
+					Content: "\n  " + rec.Time.Local().Format("01-02 15:04:05") + " ",
+					S:       c.Style{Color: color.Gray},
+				},
+				&c.Text{
+					Content: rec.Event,
+					S:       c.Style{Color: auditEventColor(rec)},
+				},
+				&c.Text{
+					Content: formatAuditDetails(rec),
+					S:       c.Style{Color: color.White},
+				},
+			)
+		}
+
+		return player.SendMessage(message)
+	})
+
+	return brigodier.Literal("history").
+		Executes(showHistory).
+		Then(brigodier.Argument("count", brigodier.Int).Executes(showHistory))
+}
+
+// gcpReportCommand creates the /gcp report subcommand
+func (g *gcpController) gcpReportCommand() brigodier.LiteralNodeBuilder {
+	showReport := g.operatorCommand(func(ctx *command.Context, player proxy.Player) error {
+		period, err := parseReportPeriod(ctx.String("period"))
+		if err != nil {
+			return player.SendMessage(&c.Text{
+				Content: err.Error() + ", e.g. 24h, 7d or 30d.",
+				S:       c.Style{Color: color.Red},
+			})
+		}
+
+		report, err := g.report(period)
+		if err != nil {
+			g.log.Error(err, "Failed to read audit log")
+			return player.SendMessage(&c.Text{
+				Content: "Failed to read the lifecycle history.",
+				S:       c.Style{Color: color.Red},
+			})
+		}
+
+		message := &c.Text{}
+		message.Extra = []c.Component{&c.Text{
+			Content: fmt.Sprintf("Cost report (last %s):", formatPeriod(period)),
+			S:       c.Style{Color: color.Gold, Bold: c.True},
+		}}
+
+		rows := report.Servers
+		if len(rows) > 1 {
+			rows = append(rows, report.Total)
+		}
+		for _, r := range rows {
+			message.Extra = append(message.Extra,
+				&c.Text{
+					Content: "\n  " + r.Server + ": ",
+					S:       c.Style{Color: color.Aqua},
+				},
+				&c.Text{
+					Content: fmt.Sprintf("uptime %s, %d starts, average session %s, idle %s",
+						formatHours(r.UptimeSeconds), r.Starts,
+						formatHours(r.AverageSessionSeconds), formatHours(r.IdleSeconds)),
+					S: c.Style{Color: color.White},
+				},
+			)
+			if report.HourlyPrice > 0 {
+				message.Extra = append(message.Extra, &c.Text{
+					Content: fmt.Sprintf("\n    cost %s vs %s always-on, saved %s (%.0f%%)",
+						g.config.Report.formatPrice(r.EstimatedCost),
+						g.config.Report.formatPrice(r.AlwaysOnCost),
+						g.config.Report.formatPrice(r.EstimatedSavings),
+						r.SavingsPercentage),
+					S: c.Style{Color: color.Green},
+				})
+			}
+		}
+		if report.HourlyPrice <= 0 {
+			message.Extra = append(message.Extra, &c.Text{
+				Content: "\n  Set report.hourlyPrice to estimate costs.",
+				S:       c.Style{Color: color.Gray},
+			})
+		}
+
+		return player.SendMessage(message)
+	})
+
+	return brigodier.Literal("report").
+		Executes(showReport).
+		Then(brigodier.Argument("period", brigodier.StringWord).Executes(showReport))
+}
+
+// gcpFlagCommand creates the /gcp flag subcommand, which flags or unflags the session of a
+// player for the operatorSession idle policy
+func (g *gcpController) gcpFlagCommand() brigodier.LiteralNodeBuilder {
+	toggleFlag := g.operatorCommand(func(ctx *command.Context, player proxy.Player) error {
+		target := player
+		if name := ctx.String("player"); name != "" {
+			target = g.proxy.PlayerByName(name)
+			if target == nil {
+				return player.SendMessage(&c.Text{
+					Content: fmt.Sprintf("Player %s is not online.", name),
+					S:       c.Style{Color: color.Red},
+				})
+			}
+		}
+
+		controller := g.controllerOf(target)
+		if controller == nil {
+			return player.SendMessage(&c.Text{
+				Content: fmt.Sprintf("%s is not on a managed server.", target.Username()),
+				S:       c.Style{Color: color.Red},
+			})
+		}
+
+		if !controller.toggleSessionFlag(target.ID().String()) {
+			return player.SendMessage(&c.Text{
+				Content: fmt.Sprintf("Unflagged the session of %s.", target.Username()),
+				S:       c.Style{Color: color.Yellow},
+			})
+		}
+
+		message := &c.Text{
+			Content: fmt.Sprintf("Flagged the session of %s, %s stops once all flagged sessions ended and nobody is online.",
+				target.Username(), controller.config.ServerAddress),
+			S: c.Style{Color: color.Green},
+		}
+		if !slices.ContainsFunc(g.config.IdlePolicies, func(p IdlePolicyConfig) bool {
+			return p.Type == idlePolicyOperatorSession
+		}) {
+			message.Extra = []c.Component{&c.Text{
+				Content: " Add the operatorSession idle policy for this to take effect.",
+				S:       c.Style{Color: color.Gray},
+			}}
+		}
+		return player.SendMessage(message)
+	})
+
+	return brigodier.Literal("flag").
+		Executes(toggleFlag).
+		Then(brigodier.Argument("player", brigodier.StringWord).Executes(toggleFlag))
+}
+
+// gcpStartCommand creates the /gcp start subcommand, which starts a managed server with a start
+// profile (default: its startProfile)
+func (g *gcpController) gcpStartCommand() brigodier.LiteralNodeBuilder {
+	start := g.operatorCommand(func(ctx *command.Context, player proxy.Player) error {
+		name := ctx.String("server")
+		controller, err := g.managedServer(name)
+		if err != nil {
+			return player.SendMessage(&c.Text{
+				Content: fmt.Sprintf("%s is not a managed server.", name),
+				S:       c.Style{Color: color.Red},
+			})
+		}
+
+		profile := ctx.String("profile")
+		if _, err := controller.startProfile(profile); err != nil {
+			return player.SendMessage(&c.Text{
+				Content: fmt.Sprintf("Unknown start profile %s.", profile),
+				S:       c.Style{Color: color.Red},
+			})
+		}
+
+		server := controller.config.ServerAddress
+		if err := player.SendMessage(&c.Text{
+			Content: fmt.Sprintf("Starting %s...", server),
+			S:       c.Style{Color: color.Yellow},
+		}); err != nil {
+			return err
+		}
+
+		// Starting may take a while, don't block the player's connection meanwhile
+		go func() {
+			startCtx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+			defer cancel()
+
+			outcome, err := controller.tryStartServer(startCtx, trigger{
+				Player:   player.Username(),
+				PlayerID: player.ID().String(),
+				Reason:   "operator_start",
+				Profile:  profile,
+			})
+			if err != nil {
+				controller.log.Error(err, "Failed to start GCP instance")
+			}
+
+			controller.mu.RLock()
+			var started string
+			if controller.startedProfile != "" {
+				started = " with start profile " + controller.startedProfile
+			}
+			controller.mu.RUnlock()
+
+			reply := &c.Text{S: c.Style{Color: color.Yellow}}
+			switch outcome {
+			case startRequested:
+				reply.Content = fmt.Sprintf("Started %s%s.", server, started)
+				reply.S.Color = color.Green
+			case startInProgress:
+				reply.Content = fmt.Sprintf("%s is already running or starting%s.", server, started)
+			case startCooldown:
+				reply.Content = fmt.Sprintf("%s was started less than %d minutes ago.",
+					server, controller.config.StartupThresholdMinutes)
+			default:
+				reply.Content = fmt.Sprintf("Failed to start %s, see /gcp history.", server)
+				reply.S.Color = color.Red
+			}
+			_ = player.SendMessage(reply)
+		}()
+		return nil
+	})
+
+	return brigodier.Literal("start").
+		Then(brigodier.Argument("server", brigodier.StringWord).
+			Executes(start).
+			Then(brigodier.Argument("profile", brigodier.StringWord).Executes(start)))
+}
+
+// gcpConsoleCommand creates the /gcp console subcommand, which shows the last lines of the serial
+// console output of a managed server's instance (default: the first server)
+func (g *gcpController) gcpConsoleCommand() brigodier.LiteralNodeBuilder {
+	showConsole := g.operatorCommand(func(ctx *command.Context, player proxy.Player) error {
+		lines := defaultConsoleLines
+		if n := ctx.Int("lines"); n > 0 {
+			lines = min(n, maxConsoleLines)
+		}
+
+		controller := g
+		if name := ctx.String("server"); name != "" {
+			var err error
+			if controller, err = g.managedServer(name); err != nil {
+				return player.SendMessage(&c.Text{
+					Content: fmt.Sprintf("%s is not a managed server.", name),
+					S:       c.Style{Color: color.Red},
+				})
+			}
+		}
+
+		output, err := controller.console(ctx, lines)
+		if err != nil {
+			controller.log.Error(err, "Failed to read serial console output")
+			return player.SendMessage(&c.Text{
+				Content: "Failed to read the serial console output.",
+				S:       c.Style{Color: color.Red},
+			})
+		}
+
+		if len(output.Lines) == 0 {
+			return player.SendMessage(&c.Text{
+				Content: fmt.Sprintf("The serial console of %s is empty.", output.Instance),
+				S:       c.Style{Color: color.Yellow},
+			})
+		}
+
+		message := &c.Text{}
+		message.Extra = []c.Component{&c.Text{
+			Content: fmt.Sprintf("Serial console of %s (last %d lines):", output.Instance, len(output.Lines)),
+			S:       c.Style{Color: color.Gold, Bold: c.True},
+		}}
+		for _, line := range output.Lines {
+			message.Extra = append(message.Extra, &c.Text{
+				Content: "\n" + line,
+				S:       c.Style{Color: color.Gray},
+			})
+		}
+		return player.SendMessage(message)
+	})
+
+	return brigodier.Literal("console").
+		Executes(showConsole).
+		Then(brigodier.Argument("lines", brigodier.Int).
+			Executes(showConsole).
+			Then(brigodier.Argument("server", brigodier.StringWord).Executes(showConsole)))
+}
+
+// auditEventColor returns the color an audit event is shown in
+func auditEventColor(rec auditRecord) color.Color {
+	switch {
+	case rec.Error != "":
+		return color.Red
+	case rec.Event == auditStartRequested || rec.Event == auditStartSucceeded:
+		return color.Green
+	case rec.Event == auditStop || rec.Event == auditSafetyShutdown || rec.Event == auditWatchdogRecovered:
+		return color.Gold
+	default:
+		return color.Aqua
+	}
+}
+
+// formatAuditDetails formats the details of an audit record for chat
+func formatAuditDetails(rec auditRecord) string {
+	var parts []string
+	if rec.Server != "" {
+		parts = append(parts, "["+rec.Server+"]")
+	}
+	if rec.Player != "" {
+		parts = append(parts, "by "+rec.Player)
+	}
+	if rec.Reason != "" {
+		parts = append(parts, "("+rec.Reason+")")
+	}
+	if rec.Instance != "" {
+		parts = append(parts, "on "+rec.Instance)
+	}
+	if rec.Profile != "" {
+		parts = append(parts, "profile "+rec.Profile)
+	}
+	if rec.StatusBefore != "" || rec.StatusAfter != "" {
+		parts = append(parts, fmt.Sprintf("%s -> %s", orUnknown(rec.StatusBefore), orUnknown(rec.StatusAfter)))
+	}
+	if rec.DurationSeconds > 0 {
+		duration := formatDuration(time.Duration(rec.DurationSeconds * float64(time.Second)))
+		switch rec.Event {
+		case auditShutdownScheduled:
+			parts = append(parts, "in "+duration)
+		case auditShutdownExtended:
+			parts = append(parts, "by "+duration)
+		default:
+			parts = append(parts, "took "+duration)
+		}
+	}
+	if rec.UptimeSeconds > 0 {
+		parts = append(parts, "uptime "+formatDuration(time.Duration(rec.UptimeSeconds*float64(time.Second))))
+	}
+	if rec.Error != "" {
+		parts = append(parts, "error: "+rec.Error)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " " + strings.Join(parts, " ")
+}
+
+// orUnknown returns s, or "?" if s is empty
+func orUnknown(s string) string {
+	if s == "" {
+		return "?"
+	}
+	return s
+}
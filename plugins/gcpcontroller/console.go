@@ -0,0 +1,103 @@
+package gcpcontroller
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Number of serial console lines shown by /gcp console and the API unless requested otherwise,
+// and the most that can be requested
+const (
+	defaultConsoleLines = 20
+	maxConsoleLines     = 1000
+)
+
+// consoleCaptureTimeout is how long capturing the serial console for the log may take
+const consoleCaptureTimeout = 30 * time.Second
+
+// ConsoleConfig configures the serial console output of the managed instance
+type ConsoleConfig struct {
+	// CaptureLines is how many lines of the serial console are written to the log when a boot
+	// times out or the watchdog recovers the instance, 0 to disable
+	CaptureLines int
+}
+
+// consoleOutput is the end of the serial console output of the active instance
+type consoleOutput struct {
+	Server   string   `json:"server"`
+	Instance string   `json:"instance"`
+	Zone     string   `json:"zone"`
+	Lines    []string `json:"lines"`
+}
+
+// console returns the last lines of the serial console output of the active instance
+func (g *gcpController) console(ctx context.Context, lines int) (*consoleOutput, error) {
+	g.mu.RLock()
+	inst := g.config.instances()[g.activeInstance]
+	g.mu.RUnlock()
+
+	output, err := g.provider.SerialPortOutput(ctx, inst)
+	if err != nil {
+		return nil, err
+	}
+	return &consoleOutput{
+		Server:   g.config.ServerAddress,
+		Instance: inst.name(),
+		Zone:     inst.Zone,
+		Lines:    tailLines(output, lines),
+	}, nil
+}
+
+// captureConsole writes the end of the serial console output to the log, so a failed boot can be
+// diagnosed without opening the Cloud Console. Must be called without g.mu held.
+func (g *gcpController) captureConsole(reason string) {
+	lines := g.config.Console.CaptureLines
+	if lines == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), consoleCaptureTimeout)
+	defer cancel()
+
+	output, err := g.console(ctx, lines)
+	if err != nil {
+		g.log.Error(err, "Failed to capture serial console output", "reason", reason)
+		return
+	}
+	g.log.Info("Serial console output",
+		"reason", reason,
+		"instance", output.Instance,
+		"output", strings.Join(output.Lines, "\n"))
+}
+
+// escapeSequence matches terminal escape sequences, e.g. colors and cursor movement of the boot log
+var escapeSequence = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|[@-Z\\-_])`)
+
+// tailLines returns the last n non-empty lines of serial console output, without escape sequences
+// and control characters
+func tailLines(output string, n int) []string {
+	output = escapeSequence.ReplaceAllString(output, "")
+
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.Map(func(r rune) rune {
+			switch {
+			case r == '\t':
+				return ' '
+			case r < ' ' || r == 0x7f:
+				return -1
+			default:
+				return r
+			}
+		}, line)
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, strings.TrimRight(line, " "))
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
@@ -0,0 +1,56 @@
+package gcpcontroller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestTailLines(t *testing.T) {
+	output := "\x1b[0m\x1b[1;32m[  OK  ]\x1b[0m Started Journal Service.\r\n" +
+		"\n" +
+		"Google startup-script:\tStarting Minecraft\r\n" +
+		"\x1b[2J\x1b[H[Server] Done (12.3s)!\n"
+
+	got := tailLines(output, 2)
+	expected := []string{"Google startup-script: Starting Minecraft", "[Server] Done (12.3s)!"}
+	if !slices.Equal(got, expected) {
+		t.Errorf("tailLines = %q, want %q", got, expected)
+	}
+
+	if got := tailLines(output, 10); len(got) != 3 || got[0] != "[  OK  ] Started Journal Service." {
+		t.Errorf("tailLines = %q, want all 3 lines", got)
+	}
+}
+
+func TestConsole(t *testing.T) {
+	g, fake := newTestController(t, statusRunning, nil)
+	fake.SetSerialOutput(testProject, testZone, testInstance, "booting\nkernel panic\n")
+
+	output, err := g.console(context.Background(), defaultConsoleLines)
+	if err != nil {
+		t.Fatalf("console: %v", err)
+	}
+	if output.Instance != testInstance || !slices.Equal(output.Lines, []string{"booting", "kernel panic"}) {
+		t.Errorf("console = %+v", output)
+	}
+
+	rec := httptest.NewRecorder()
+	g.handleConsole(rec, httptest.NewRequest(http.MethodGet, "/console?lines=1", nil))
+	var resp consoleOutput
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET /console = %d, %v", rec.Code, err)
+	}
+	if !slices.Equal(resp.Lines, []string{"kernel panic"}) {
+		t.Errorf("GET /console lines = %q, want the last line", resp.Lines)
+	}
+
+	rec = httptest.NewRecorder()
+	g.handleConsole(rec, httptest.NewRequest(http.MethodGet, "/console?lines=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /console?lines=0 = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
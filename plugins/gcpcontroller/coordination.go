@@ -0,0 +1,421 @@
+package gcpcontroller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Supported values for coordination.backend
+const coordinationFile = "file"
+
+// leaseLockStaleAfter is how long a lease lock file may exist before it is considered
+// left behind by a crashed replica
+const leaseLockStaleAfter = 10 * time.Second
+
+// CoordinationConfig configures sharing state between several proxy replicas that manage the same instances
+type CoordinationConfig struct {
+	Enabled bool
+	// Backend is where the replicas share their state, currently only "file"
+	Backend string
+	// Path is the directory shared by all replicas for the file backend
+	Path string
+	// ReplicaID identifies this proxy, defaults to the hostname
+	ReplicaID string
+	// HeartbeatSeconds is how often this replica publishes its state
+	HeartbeatSeconds int
+	// StaleSeconds is how long a replica may miss heartbeats before it is ignored
+	StaleSeconds int
+	// LeaseSeconds is how long a replica may hold the lease for a start or stop
+	LeaseSeconds int
+}
+
+// serverActivity is the activity of a managed server as seen by one replica
+type serverActivity struct {
+	Players  int       `json:"players"`
+	LastJoin time.Time `json:"lastJoin,omitempty"`
+}
+
+// replicaState is the state a replica publishes on every heartbeat
+type replicaState struct {
+	ReplicaID string                    `json:"replicaId"`
+	Heartbeat time.Time                 `json:"heartbeat"`
+	Servers   map[string]serverActivity `json:"servers"`
+}
+
+// coordinationStore is the shared state of all replicas
+type coordinationStore interface {
+	// Publish writes the state of a replica
+	Publish(ctx context.Context, state replicaState) error
+	// Remove deletes the state of a replica that shuts down
+	Remove(ctx context.Context, replicaID string) error
+	// Replicas returns the last published state of all replicas
+	Replicas(ctx context.Context) ([]replicaState, error)
+	// AcquireLease takes or renews the lease name for holder unless another holder has an unexpired lease
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	// ReleaseLease gives up the lease name if holder holds it
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
+
+// coordinator publishes the activity of this replica and answers questions about the other replicas
+type coordinator struct {
+	id     string
+	config CoordinationConfig
+	store  coordinationStore
+	log    logr.Logger
+
+	mu          sync.Mutex
+	controllers []*gcpController
+	changed     chan struct{}
+}
+
+// newCoordinator creates the coordinator for the configured backend
+func newCoordinator(config CoordinationConfig, log logr.Logger) (*coordinator, error) {
+	id := config.ReplicaID
+	if id == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine replica ID from hostname: %w", err)
+		}
+		id = hostname
+	}
+
+	var store coordinationStore
+	switch config.Backend {
+	case coordinationFile:
+		store = &fileStore{dir: config.Path}
+	default:
+		return nil, fmt.Errorf("unsupported coordination backend %q", config.Backend)
+	}
+
+	return &coordinator{
+		id:      id,
+		config:  config,
+		store:   store,
+		log:     log.WithValues("replica", id),
+		changed: make(chan struct{}, 1),
+	}, nil
+}
+
+// add registers a controller whose activity is published
+func (c *coordinator) add(g *gcpController) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.controllers = append(c.controllers, g)
+}
+
+// run publishes the state of this replica on every heartbeat and when it changed,
+// and removes it when ctx is done
+func (c *coordinator) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(c.config.HeartbeatSeconds) * time.Second)
+	defer ticker.Stop()
+
+	c.publish(ctx)
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.changed:
+		case <-ctx.Done():
+			removeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := c.store.Remove(removeCtx, c.id); err != nil {
+				c.log.Error(err, "Failed to remove replica state")
+			}
+			return
+		}
+		c.publish(ctx)
+	}
+}
+
+// notify publishes the state of this replica soon, e.g. after the player count changed
+func (c *coordinator) notify() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// publish writes the current activity of all managed servers to the store
+func (c *coordinator) publish(ctx context.Context) {
+	c.mu.Lock()
+	controllers := c.controllers
+	c.mu.Unlock()
+
+	state := replicaState{
+		ReplicaID: c.id,
+		Heartbeat: time.Now(),
+		Servers:   make(map[string]serverActivity, len(controllers)),
+	}
+	for _, g := range controllers {
+		activity := serverActivity{Players: int(g.sharedPlayers.Load())}
+		if lastJoin := g.sharedLastJoin.Load(); lastJoin != 0 {
+			activity.LastJoin = time.Unix(0, lastJoin)
+		}
+		state.Servers[g.config.ServerAddress] = activity
+	}
+
+	if err := c.store.Publish(ctx, state); err != nil {
+		c.log.Error(err, "Failed to publish replica state")
+	}
+}
+
+// shareActivity copies the player count and last join for the coordinator and publishes them
+// soon. Must be called with g.mu held.
+func (g *gcpController) shareActivity() {
+	g.sharedPlayers.Store(int64(g.playerCount))
+	if !g.lastJoin.IsZero() {
+		g.sharedLastJoin.Store(g.lastJoin.UnixNano())
+	}
+	if g.coordinator != nil {
+		g.coordinator.notify()
+	}
+}
+
+// remoteActivity sums up the activity of a managed server on all other live replicas
+func (c *coordinator) remoteActivity(ctx context.Context, server string) (serverActivity, error) {
+	replicas, err := c.store.Replicas(ctx)
+	if err != nil {
+		return serverActivity{}, fmt.Errorf("failed to read replica states: %w", err)
+	}
+
+	stale := time.Duration(c.config.StaleSeconds) * time.Second
+	var total serverActivity
+	for _, replica := range replicas {
+		if replica.ReplicaID == c.id {
+			continue
+		}
+		if time.Since(replica.Heartbeat) > stale {
+			c.log.V(1).Info("Ignoring stale replica",
+				"otherReplica", replica.ReplicaID,
+				"heartbeat", replica.Heartbeat)
+			continue
+		}
+		activity := replica.Servers[server]
+		total.Players += activity.Players
+		if activity.LastJoin.After(total.LastJoin) {
+			total.LastJoin = activity.LastJoin
+		}
+	}
+	return total, nil
+}
+
+// acquireLease takes the lease for starting or stopping a managed server
+func (c *coordinator) acquireLease(ctx context.Context, server string) (bool, error) {
+	return c.store.AcquireLease(ctx, server, c.id, time.Duration(c.config.LeaseSeconds)*time.Second)
+}
+
+// releaseLease gives up the lease for a managed server
+func (c *coordinator) releaseLease(server string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.store.ReleaseLease(ctx, server, c.id); err != nil {
+		c.log.Error(err, "Failed to release lease", "server", server)
+	}
+}
+
+// releaseLease gives up the lease taken for a start or stop, unless an operation awaited in the
+// background still holds it. Must be called with g.mu held.
+func (g *gcpController) releaseLease() {
+	if g.leaseOperations > 0 {
+		return
+	}
+	g.coordinator.releaseLease(g.config.ServerAddress)
+}
+
+// lease is the content of a lease file
+type lease struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// fileStore keeps the shared state as JSON files in a directory, e.g. on a network file system
+// mounted by all replicas or a local directory when the replicas run on the same host
+type fileStore struct {
+	dir string
+}
+
+// Publish writes the state of a replica to replica-<id>.json
+func (s *fileStore) Publish(_ context.Context, state replicaState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal replica state: %w", err)
+	}
+	return s.writeFile(s.replicaPath(state.ReplicaID), data)
+}
+
+// Remove deletes the state file of a replica
+func (s *fileStore) Remove(_ context.Context, replicaID string) error {
+	if err := os.Remove(s.replicaPath(replicaID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove replica state: %w", err)
+	}
+	return nil
+}
+
+// Replicas reads the state files of all replicas. Files that can't be parsed are skipped.
+func (s *fileStore) Replicas(_ context.Context) ([]replicaState, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "replica-*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var replicas []replicaState
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read replica state: %w", err)
+		}
+		var state replicaState
+		if err := json.Unmarshal(data, &state); err != nil {
+			continue
+		}
+		replicas = append(replicas, state)
+	}
+	return replicas, nil
+}
+
+// AcquireLease takes or renews the lease in lease-<name>.json. The read-modify-write is
+// guarded by an exclusively created lock file.
+func (s *fileStore) AcquireLease(_ context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	unlock, err := s.lock(name)
+	if errors.Is(err, errLeaseLocked) {
+		// Another replica is taking or releasing the lease right now
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	current, err := s.readLease(name)
+	if err != nil {
+		return false, err
+	}
+	if current.Holder != "" && current.Holder != holder && time.Now().Before(current.ExpiresAt) {
+		return false, nil
+	}
+
+	data, err := json.Marshal(lease{Holder: holder, ExpiresAt: time.Now().Add(ttl)})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal lease: %w", err)
+	}
+	if err := s.writeFile(s.leasePath(name), data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseLease deletes the lease file if holder holds the lease
+func (s *fileStore) ReleaseLease(_ context.Context, name, holder string) error {
+	unlock, err := s.lock(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current, err := s.readLease(name)
+	if err != nil {
+		return err
+	}
+	if current.Holder != holder {
+		return nil
+	}
+	if err := os.Remove(s.leasePath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove lease: %w", err)
+	}
+	return nil
+}
+
+// readLease reads a lease file, returning an empty lease if there is none
+func (s *fileStore) readLease(name string) (lease, error) {
+	var current lease
+	data, err := os.ReadFile(s.leasePath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return current, nil
+		}
+		return current, fmt.Errorf("failed to read lease: %w", err)
+	}
+	if err := json.Unmarshal(data, &current); err != nil {
+		// A corrupt lease is treated as expired
+		return lease{}, nil
+	}
+	return current, nil
+}
+
+// errLeaseLocked is returned by fileStore.lock if another replica holds the lock file of a lease
+var errLeaseLocked = errors.New("lease is locked by another replica")
+
+// lock creates the lock file of a lease, removing it when it was left behind by a crashed replica
+func (s *fileStore) lock(name string) (func(), error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create coordination directory: %w", err)
+	}
+
+	path := s.leasePath(name) + ".lock"
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create lease lock: %w", err)
+		}
+
+		info, statErr := os.Stat(path)
+		if statErr != nil || time.Since(info.ModTime()) < leaseLockStaleAfter {
+			return nil, fmt.Errorf("%w: %s", errLeaseLocked, name)
+		}
+		os.Remove(path)
+	}
+	return nil, fmt.Errorf("%w: %s", errLeaseLocked, name)
+}
+
+// writeFile replaces a file atomically, so other replicas never read a partial file
+func (s *fileStore) writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create coordination directory: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// replicaPath returns the path of a replica's state file
+func (s *fileStore) replicaPath(replicaID string) string {
+	return filepath.Join(s.dir, "replica-"+sanitizeFileName(replicaID)+".json")
+}
+
+// leasePath returns the path of a lease file
+func (s *fileStore) leasePath(name string) string {
+	return filepath.Join(s.dir, "lease-"+sanitizeFileName(name)+".json")
+}
+
+// sanitizeFileName replaces characters that are not safe in file names
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
@@ -0,0 +1,184 @@
+package gcpcontroller
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/minekube/gate-plugin-template/plugins/gcpcontroller/internal/fakecompute"
+)
+
+// newTestCoordinator creates a coordinator of the replica id sharing dir with the other replicas
+func newTestCoordinator(t *testing.T, dir, id string) *coordinator {
+	t.Helper()
+
+	c, err := newCoordinator(CoordinationConfig{
+		Backend:          coordinationFile,
+		Path:             dir,
+		ReplicaID:        id,
+		HeartbeatSeconds: 10,
+		StaleSeconds:     30,
+		LeaseSeconds:     60,
+	}, logr.Discard())
+	if err != nil {
+		t.Fatalf("newCoordinator: %v", err)
+	}
+	return c
+}
+
+func TestRemoteActivity(t *testing.T) {
+	dir := t.TempDir()
+	local := newTestCoordinator(t, dir, "proxy-a")
+	ctx := context.Background()
+
+	lastJoin := time.Now().Add(-time.Minute).Round(time.Millisecond)
+	for _, state := range []replicaState{
+		{ReplicaID: "proxy-b", Heartbeat: time.Now(), Servers: map[string]serverActivity{
+			testServer: {Players: 2, LastJoin: lastJoin},
+		}},
+		// Missed its heartbeats, e.g. because it crashed
+		{ReplicaID: "proxy-c", Heartbeat: time.Now().Add(-time.Minute), Servers: map[string]serverActivity{
+			testServer: {Players: 5, LastJoin: time.Now()},
+		}},
+		// This replica's own state doesn't count
+		{ReplicaID: "proxy-a", Heartbeat: time.Now(), Servers: map[string]serverActivity{
+			testServer: {Players: 1},
+		}},
+	} {
+		if err := local.store.Publish(ctx, state); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	remote, err := local.remoteActivity(ctx, testServer)
+	if err != nil {
+		t.Fatalf("remoteActivity: %v", err)
+	}
+	if remote.Players != 2 || !remote.LastJoin.Equal(lastJoin) {
+		t.Errorf("remote activity = %+v, want 2 players of proxy-b who joined at %v", remote, lastJoin)
+	}
+}
+
+func TestLease(t *testing.T) {
+	dir := t.TempDir()
+	a := newTestCoordinator(t, dir, "proxy-a")
+	b := newTestCoordinator(t, dir, "proxy-b")
+	ctx := context.Background()
+
+	if ok, err := a.acquireLease(ctx, testServer); err != nil || !ok {
+		t.Fatalf("proxy-a acquireLease = %v, %v, want true", ok, err)
+	}
+	if ok, err := b.acquireLease(ctx, testServer); err != nil || ok {
+		t.Fatalf("proxy-b acquireLease while held = %v, %v, want false", ok, err)
+	}
+	// The holder may renew its lease
+	if ok, err := a.acquireLease(ctx, testServer); err != nil || !ok {
+		t.Fatalf("proxy-a renewing = %v, %v, want true", ok, err)
+	}
+
+	// Releasing a lease held by another replica has no effect
+	b.releaseLease(testServer)
+	if ok, _ := b.acquireLease(ctx, testServer); ok {
+		t.Fatal("proxy-b acquired the lease after releasing a lease it didn't hold")
+	}
+
+	a.releaseLease(testServer)
+	if ok, err := b.acquireLease(ctx, testServer); err != nil || !ok {
+		t.Fatalf("proxy-b acquireLease after release = %v, %v, want true", ok, err)
+	}
+
+	// An expired lease is taken over
+	if ok, err := b.store.AcquireLease(ctx, "other", "proxy-b", -time.Second); err != nil || !ok {
+		t.Fatalf("AcquireLease = %v, %v, want true", ok, err)
+	}
+	if ok, err := a.acquireLease(ctx, "other"); err != nil || !ok {
+		t.Errorf("proxy-a acquireLease of an expired lease = %v, %v, want true", ok, err)
+	}
+}
+
+func TestPublishWithoutLifecycleLock(t *testing.T) {
+	g, _ := newTestController(t, statusRunning, nil)
+	c := newTestCoordinator(t, t.TempDir(), "proxy-a")
+	g.coordinator = c
+	c.add(g)
+
+	g.mu.Lock()
+	g.playerCount = 3
+	g.lastJoin = time.Now()
+	g.shareActivity()
+	g.mu.Unlock()
+
+	// A long start or stop holds g.mu, the heartbeat must not wait for it
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.publish(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish blocked while g.mu was held")
+	}
+
+	replicas, err := c.store.Replicas(context.Background())
+	if err != nil || len(replicas) != 1 {
+		t.Fatalf("Replicas = %v, %v, want the published state", replicas, err)
+	}
+	if players := replicas[0].Servers[testServer].Players; players != 3 {
+		t.Errorf("published players = %d, want 3", players)
+	}
+}
+
+func TestLeaseContention(t *testing.T) {
+	dir := t.TempDir()
+	g, fake := newTestController(t, statusTerminated, nil)
+	g.coordinator = newTestCoordinator(t, dir, "proxy-a")
+
+	// Another replica is taking the lease right now
+	lock := g.coordinator.store.(*fileStore).leasePath(testServer) + ".lock"
+	if err := os.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatalf("failed to create lock file: %v", err)
+	}
+	if ok, err := g.coordinator.acquireLease(context.Background(), testServer); err != nil || ok {
+		t.Errorf("acquireLease while locked = %v, %v, want false, nil", ok, err)
+	}
+	if outcome, err := g.tryStartServer(context.Background(), trigger{Reason: "player_connect"}); err != nil || outcome != startInProgress {
+		t.Errorf("tryStartServer while locked = %v, %v, want %v", outcome, err, startInProgress)
+	}
+	if n := fake.Requests(fakecompute.ActionStart); n != 0 {
+		t.Errorf("start requests = %d, want 0", n)
+	}
+}
+
+func TestLeaseHeldByBackgroundOperation(t *testing.T) {
+	dir := t.TempDir()
+	g, fake := newTestController(t, statusTerminated, nil)
+	g.coordinator = newTestCoordinator(t, dir, "proxy-a")
+	other := newTestCoordinator(t, dir, "proxy-b")
+
+	// The connection gives up waiting, so the operation is awaited in the background
+	fake.SetDelay(fakecompute.ActionStart, 2*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := g.tryStartServer(ctx, trigger{Reason: "player_connect"}); err != nil {
+		t.Fatalf("tryStartServer: %v", err)
+	}
+
+	if ok, err := other.acquireLease(context.Background(), testServer); err != nil || ok {
+		t.Errorf("proxy-b acquireLease during the operation = %v, %v, want false", ok, err)
+	}
+	waitFor(t, "operation to complete", func() bool {
+		g.mu.RLock()
+		defer g.mu.RUnlock()
+		return !g.pendingStart
+	})
+	if ok, err := other.acquireLease(context.Background(), testServer); err != nil || !ok {
+		t.Errorf("proxy-b acquireLease after the operation = %v, %v, want true", ok, err)
+	}
+}
@@ -0,0 +1,368 @@
+package gcpcontroller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	dns "google.golang.org/api/dns/v1"
+)
+
+// Supported values for dns.provider
+const (
+	dnsProviderCloudDNS = "cloudDNS"
+	dnsProviderHTTP     = "http"
+)
+
+// Supported values for dns.onStop
+const (
+	dnsOnStopRemove = "remove"
+	dnsOnStopPark   = "park"
+)
+
+// dnsUpdateTimeout is how long a DNS update may take, including waiting for the instance's IP
+const dnsUpdateTimeout = 2 * time.Minute
+
+// dnsIPPollInterval is how often the instance is looked up while it has no IP yet
+const dnsIPPollInterval = 5 * time.Second
+
+// DNSConfig configures the A record that is pointed at the instance while it runs
+type DNSConfig struct {
+	// Provider is the DNS API: cloudDNS or http. DNS updates are disabled if empty.
+	Provider string
+	// Name is the record of the top-level server, e.g. mc.example.com
+	Name string
+	TTL  int
+	// AddressSource is which IP of the instance the record points at: external (default) or internal
+	AddressSource string
+	// OnStop is what happens to the record when the instance stops: remove (default) or park
+	OnStop string
+	// ParkIP is the IP the record points at while the instance is stopped, with onStop park
+	ParkIP   string
+	CloudDNS CloudDNSConfig
+	HTTP     DNSHTTPConfig
+}
+
+// CloudDNSConfig configures the Cloud DNS zone holding the record
+type CloudDNSConfig struct {
+	// Project of the managed zone (default: projectId)
+	Project     string
+	ManagedZone string
+}
+
+// DNSHTTPConfig configures a generic HTTP request that updates the record, e.g. a webhook of a DNS
+// provider. URL, body and headers may contain {action} (upsert or remove), {name}, {ip} and {ttl},
+// and headers environment variables like ${DNS_TOKEN}.
+type DNSHTTPConfig struct {
+	URL     string
+	Method  string
+	Headers []string
+	Body    string
+}
+
+// validate checks the DNS settings and fills in their defaults
+func (c *DNSConfig) validate(projectID string) error {
+	if c.Provider == "" {
+		return nil
+	}
+	c.Name = normalizeDNSName(c.Name)
+	if c.TTL == 0 {
+		c.TTL = 60
+	}
+	if c.TTL < 1 {
+		return fmt.Errorf("gcpController.dns.ttl must be at least 1")
+	}
+	if c.AddressSource == "" {
+		c.AddressSource = addressSourceExternal
+	}
+	if c.AddressSource != addressSourceExternal && c.AddressSource != addressSourceInternal {
+		return fmt.Errorf("gcpController.dns.addressSource must be %q or %q, got %q",
+			addressSourceExternal, addressSourceInternal, c.AddressSource)
+	}
+
+	switch c.OnStop {
+	case "":
+		c.OnStop = dnsOnStopRemove
+	case dnsOnStopRemove:
+	case dnsOnStopPark:
+		if ip := net.ParseIP(c.ParkIP); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("gcpController.dns.parkIP must be an IPv4 address with onStop %q", dnsOnStopPark)
+		}
+	default:
+		return fmt.Errorf("gcpController.dns.onStop must be %q or %q, got %q", dnsOnStopRemove, dnsOnStopPark, c.OnStop)
+	}
+
+	switch c.Provider {
+	case dnsProviderCloudDNS:
+		if c.CloudDNS.Project == "" {
+			c.CloudDNS.Project = projectID
+		}
+		if c.CloudDNS.ManagedZone == "" {
+			return fmt.Errorf("gcpController.dns.cloudDNS.managedZone is required")
+		}
+	case dnsProviderHTTP:
+		if c.HTTP.URL == "" {
+			return fmt.Errorf("gcpController.dns.http.url is required")
+		}
+		if c.HTTP.Method == "" {
+			c.HTTP.Method = http.MethodPost
+		}
+		for _, header := range c.HTTP.Headers {
+			if name, _, ok := strings.Cut(header, ":"); !ok || strings.TrimSpace(name) == "" {
+				return fmt.Errorf("gcpController.dns.http.headers item %q must be \"Name: value\"", header)
+			}
+		}
+	default:
+		return fmt.Errorf("gcpController.dns.provider must be %q or %q, got %q",
+			dnsProviderCloudDNS, dnsProviderHTTP, c.Provider)
+	}
+	return nil
+}
+
+// normalizeDNSName returns a record name in lowercase without the trailing dot
+func normalizeDNSName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// dnsProvider updates A records
+type dnsProvider interface {
+	// Upsert points the A record name at ip, creating it if needed
+	Upsert(ctx context.Context, name, ip string, ttl int) error
+	// Remove deletes the A record name. It succeeds if the record doesn't exist.
+	Remove(ctx context.Context, name string) error
+}
+
+// newDNSProvider creates the DNS provider selected in the configuration, or nil if DNS updates are disabled
+func newDNSProvider(ctx context.Context, config *Config) (dnsProvider, error) {
+	switch config.DNS.Provider {
+	case dnsProviderCloudDNS:
+		opts, err := credentialOptions(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		service, err := dns.NewService(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Cloud DNS client: %w", err)
+		}
+		return &cloudDNSProvider{
+			records: service.ResourceRecordSets,
+			project: config.DNS.CloudDNS.Project,
+			zone:    config.DNS.CloudDNS.ManagedZone,
+		}, nil
+	case dnsProviderHTTP:
+		return &httpDNSProvider{config: config.DNS.HTTP, client: &http.Client{Timeout: 30 * time.Second}}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// cloudDNSProvider updates records in a Cloud DNS managed zone
+type cloudDNSProvider struct {
+	records *dns.ResourceRecordSetsService
+	project string
+	zone    string
+}
+
+// Upsert replaces the record if it exists and creates it otherwise
+func (p *cloudDNSProvider) Upsert(ctx context.Context, name, ip string, ttl int) error {
+	rrset := &dns.ResourceRecordSet{
+		Name:    name + ".",
+		Type:    "A",
+		Ttl:     int64(ttl),
+		Rrdatas: []string{ip},
+	}
+
+	_, err := p.records.Patch(p.project, p.zone, rrset.Name, rrset.Type, rrset).Context(ctx).Do()
+	if isNotFound(err) {
+		_, err = p.records.Create(p.project, p.zone, rrset).Context(ctx).Do()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update Cloud DNS record %s: %w", name, err)
+	}
+	return nil
+}
+
+// Remove deletes the record
+func (p *cloudDNSProvider) Remove(ctx context.Context, name string) error {
+	_, err := p.records.Delete(p.project, p.zone, name+".", "A").Context(ctx).Do()
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to delete Cloud DNS record %s: %w", name, err)
+	}
+	return nil
+}
+
+// httpDNSProvider sends the configured HTTP request for every update
+type httpDNSProvider struct {
+	config DNSHTTPConfig
+	client *http.Client
+}
+
+// Upsert sends the request with {action} upsert
+func (p *httpDNSProvider) Upsert(ctx context.Context, name, ip string, ttl int) error {
+	return p.send(ctx, "upsert", name, ip, ttl)
+}
+
+// Remove sends the request with {action} remove and an empty {ip}
+func (p *httpDNSProvider) Remove(ctx context.Context, name string) error {
+	return p.send(ctx, "remove", name, "", 0)
+}
+
+// send fills in the placeholders and sends the request. Any status but 2xx is an error.
+func (p *httpDNSProvider) send(ctx context.Context, action, name, ip string, ttl int) error {
+	replacer := strings.NewReplacer(
+		"{action}", action,
+		"{name}", name,
+		"{ip}", ip,
+		"{ttl}", strconv.Itoa(ttl),
+	)
+
+	var body io.Reader
+	if p.config.Body != "" {
+		body = strings.NewReader(replacer.Replace(p.config.Body))
+	}
+	req, err := http.NewRequestWithContext(ctx, p.config.Method, replacer.Replace(p.config.URL), body)
+	if err != nil {
+		return fmt.Errorf("failed to create DNS update request: %w", err)
+	}
+	for _, header := range p.config.Headers {
+		key, value, _ := strings.Cut(header, ":")
+		req.Header.Set(strings.TrimSpace(key), replacer.Replace(os.ExpandEnv(strings.TrimSpace(value))))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send DNS update request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("DNS update request failed with %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// dnsRecord keeps the A record of a managed server in sync with its instance. Updates run in the
+// background in the order they were requested; an update that was superseded before it ran is skipped.
+type dnsRecord struct {
+	provider dnsProvider
+	config   DNSConfig
+	log      logr.Logger
+
+	mu     sync.Mutex // held while an update runs
+	seqMu  sync.Mutex
+	latest int // sequence number of the last requested update
+}
+
+// next returns the sequence number of a new update
+func (r *dnsRecord) next() int {
+	r.seqMu.Lock()
+	defer r.seqMu.Unlock()
+	r.latest++
+	return r.latest
+}
+
+// superseded reports whether an update was requested after the one with the given sequence number
+func (r *dnsRecord) superseded(seq int) bool {
+	r.seqMu.Lock()
+	defer r.seqMu.Unlock()
+	return seq != r.latest
+}
+
+// publishDNS points the DNS record at the IP of a started instance in the background,
+// waiting for the instance to get one
+func (g *gcpController) publishDNS(inst InstanceConfig) {
+	r := g.dns
+	if r == nil {
+		return
+	}
+	seq := r.next()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), dnsUpdateTimeout)
+		defer cancel()
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		ip, err := g.waitForIP(ctx, inst, r.config.AddressSource, func() bool { return r.superseded(seq) })
+		if r.superseded(seq) {
+			return
+		}
+		if err != nil {
+			r.log.Error(err, "Failed to update DNS record, instance has no IP", "name", r.config.Name, "instance", inst.name())
+			return
+		}
+
+		if err := r.provider.Upsert(ctx, r.config.Name, ip, r.config.TTL); err != nil {
+			r.log.Error(err, "Failed to update DNS record", "name", r.config.Name, "ip", ip)
+			return
+		}
+		r.log.Info("Updated DNS record", "name", r.config.Name, "ip", ip, "ttl", r.config.TTL)
+	}()
+}
+
+// unpublishDNS removes or parks the DNS record in the background after the instance stopped
+func (g *gcpController) unpublishDNS() {
+	r := g.dns
+	if r == nil {
+		return
+	}
+	seq := r.next()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), dnsUpdateTimeout)
+		defer cancel()
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.superseded(seq) {
+			return
+		}
+
+		if r.config.OnStop == dnsOnStopPark {
+			if err := r.provider.Upsert(ctx, r.config.Name, r.config.ParkIP, r.config.TTL); err != nil {
+				r.log.Error(err, "Failed to park DNS record", "name", r.config.Name, "ip", r.config.ParkIP)
+				return
+			}
+			r.log.Info("Parked DNS record", "name", r.config.Name, "ip", r.config.ParkIP)
+			return
+		}
+		if err := r.provider.Remove(ctx, r.config.Name); err != nil {
+			r.log.Error(err, "Failed to remove DNS record", "name", r.config.Name)
+			return
+		}
+		r.log.Info("Removed DNS record", "name", r.config.Name)
+	}()
+}
+
+// waitForIP looks up the instance until it has an IP of the given source, e.g. while an instance
+// group creates its instance. It gives up when ctx is done or cancelled returns true.
+func (g *gcpController) waitForIP(ctx context.Context, inst InstanceConfig, source string, cancelled func() bool) (string, error) {
+	for {
+		info, err := g.provider.Get(ctx, inst)
+		if err == nil {
+			var ip string
+			if ip, err = info.ip(source); err == nil {
+				return ip, nil
+			}
+		}
+		if cancelled() {
+			return "", err
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", err
+		case <-time.After(dnsIPPollInterval):
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package gcpcontroller
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+// fakeDNS records the updates of a DNS record
+type fakeDNS struct {
+	mu      sync.Mutex
+	updates []string
+}
+
+func (f *fakeDNS) Upsert(_ context.Context, name, ip string, ttl int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates = append(f.updates, "upsert "+name+" "+ip)
+	return nil
+}
+
+func (f *fakeDNS) Remove(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates = append(f.updates, "remove "+name)
+	return nil
+}
+
+func (f *fakeDNS) all() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.updates...)
+}
+
+func TestDNSConfigValidate(t *testing.T) {
+	c := DNSConfig{Provider: dnsProviderCloudDNS, Name: "MC.Example.com.", CloudDNS: CloudDNSConfig{ManagedZone: "example"}}
+	if err := c.validate(testProject); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if c.Name != "mc.example.com" || c.TTL != 60 || c.AddressSource != addressSourceExternal ||
+		c.OnStop != dnsOnStopRemove || c.CloudDNS.Project != testProject {
+		t.Errorf("defaults = %+v", c)
+	}
+
+	for name, c := range map[string]DNSConfig{
+		"unknown provider":  {Provider: "route53"},
+		"no managed zone":   {Provider: dnsProviderCloudDNS},
+		"no url":            {Provider: dnsProviderHTTP},
+		"park without ip":   {Provider: dnsProviderHTTP, HTTP: DNSHTTPConfig{URL: "http://dns"}, OnStop: dnsOnStopPark},
+		"invalid header":    {Provider: dnsProviderHTTP, HTTP: DNSHTTPConfig{URL: "http://dns", Headers: []string{"token"}}},
+		"invalid source":    {Provider: dnsProviderHTTP, HTTP: DNSHTTPConfig{URL: "http://dns"}, AddressSource: "dns"},
+		"invalid stop mode": {Provider: dnsProviderHTTP, HTTP: DNSHTTPConfig{URL: "http://dns"}, OnStop: "keep"},
+		"park with ipv6 ip": {Provider: dnsProviderHTTP, HTTP: DNSHTTPConfig{URL: "http://dns"}, OnStop: dnsOnStopPark, ParkIP: "::1"},
+	} {
+		if err := c.validate(testProject); err == nil {
+			t.Errorf("%s: validate succeeded, want error", name)
+		}
+	}
+}
+
+func TestHTTPDNSProvider(t *testing.T) {
+	t.Setenv("DNS_TOKEN", "secret")
+
+	var method, path, auth, body string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		method, path, auth, body = r.Method, r.URL.RequestURI(), r.Header.Get("Authorization"), string(b)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("zone is locked"))
+	}))
+	defer srv.Close()
+
+	p := &httpDNSProvider{
+		config: DNSHTTPConfig{
+			URL:     srv.URL + "/records/{name}?action={action}",
+			Method:  http.MethodPut,
+			Headers: []string{"Authorization: Bearer ${DNS_TOKEN}"},
+			Body:    `{"ip":"{ip}","ttl":{ttl}}`,
+		},
+		client: srv.Client(),
+	}
+
+	if err := p.Upsert(context.Background(), "mc.example.com", "203.0.113.7", 60); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if method != http.MethodPut || path != "/records/mc.example.com?action=upsert" ||
+		auth != "Bearer secret" || body != `{"ip":"203.0.113.7","ttl":60}` {
+		t.Errorf("request = %s %s, Authorization %q, body %s", method, path, auth, body)
+	}
+
+	status = http.StatusConflict
+	err := p.Remove(context.Background(), "mc.example.com")
+	if err == nil || !strings.Contains(err.Error(), "zone is locked") {
+		t.Errorf("Remove error = %v, want error with the response body", err)
+	}
+	if path != "/records/mc.example.com?action=remove" {
+		t.Errorf("path = %s, want remove action", path)
+	}
+}
+
+func TestPublishDNS(t *testing.T) {
+	g, _ := newTestController(t, statusRunning, nil)
+	fake := &fakeDNS{}
+	g.dns = &dnsRecord{
+		provider: fake,
+		config:   DNSConfig{Name: "mc.example.com", TTL: 60, AddressSource: addressSourceInternal, OnStop: dnsOnStopRemove},
+		log:      logr.Discard(),
+	}
+
+	g.publishDNS(g.config.instances()[0])
+	waitFor(t, "DNS upsert", func() bool { return len(fake.all()) == 1 })
+	if got := fake.all()[0]; got != "upsert mc.example.com 10.0.0.2" {
+		t.Errorf("update = %q, want upsert with the instance IP", got)
+	}
+
+	g.unpublishDNS()
+	waitFor(t, "DNS remove", func() bool { return len(fake.all()) == 2 })
+	if got := fake.all()[1]; got != "remove mc.example.com" {
+		t.Errorf("update = %q, want remove", got)
+	}
+
+	g.dns.mu.Lock()
+	g.dns.config.OnStop = dnsOnStopPark
+	g.dns.config.ParkIP = "192.0.2.1"
+	g.dns.mu.Unlock()
+	g.unpublishDNS()
+	waitFor(t, "DNS park", func() bool { return len(fake.all()) == 3 })
+	if got := fake.all()[2]; got != "upsert mc.example.com 192.0.2.1" {
+		t.Errorf("update = %q, want upsert with the park IP", got)
+	}
+}
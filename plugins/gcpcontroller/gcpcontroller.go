@@ -4,17 +4,17 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	compute "cloud.google.com/go/compute/apiv1"
-	"cloud.google.com/go/compute/apiv1/computepb"
 	"github.com/go-logr/logr"
 	"github.com/robinbraemer/event"
 	"github.com/spf13/viper"
-	c "go.minekube.com/common/minecraft/component"
 	"go.minekube.com/gate/pkg/edition/java/proxy"
-	"google.golang.org/api/option"
 )
 
 // Plugin is the GCP controller plugin that manages backend server lifecycle
@@ -30,56 +30,222 @@ var Plugin = proxy.Plugin{
 			return fmt.Errorf("failed to load GCP controller config: %w", err)
 		}
 
-		// Create GCP client
-		var clientOpts []option.ClientOption
-		if config.CredentialsPath != "" {
-			clientOpts = append(clientOpts, option.WithCredentialsFile(config.CredentialsPath))
+		// Create instance provider
+		provider, err := newProvider(ctx, config, log)
+		if err != nil {
+			return err
+		}
+
+		// Report missing IAM permissions now rather than on the first start
+		if config.Provider == providerGCP && config.Auth.SelfCheck {
+			go checkPermissions(ctx, provider, config, log)
 		}
 
-		client, err := compute.NewInstancesRESTClient(ctx, clientOpts...)
+		// Points DNS records at the instances of the managed servers
+		dnsProvider, err := newDNSProvider(ctx, config)
 		if err != nil {
-			return fmt.Errorf("failed to create GCP compute client: %w", err)
+			return err
+		}
+
+		// Shared by all managed servers
+		audit := &auditLog{path: config.AuditLogPath}
+		operations := &operationStore{path: filepath.Join(config.DataDir, "operations.json")}
+		if err := operations.load(); err != nil {
+			log.Error(err, "Failed to load pending operations")
+		}
+
+		var coord *coordinator
+		if config.Coordination.Enabled {
+			coord, err = newCoordinator(config.Coordination, log)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Create a controller for every managed server
+		var controllers []*gcpController
+		for i, serverConfig := range config.servers() {
+			serverLog := log.WithValues("server", serverConfig.ServerAddress)
+
+			// Load boot history used for the ETA shown to players
+			historyFile := "boot-history.json"
+			if i > 0 {
+				historyFile = fmt.Sprintf("boot-history-%s.json", serverConfig.ServerAddress)
+			}
+			bootHistory := newBootHistory(
+				filepath.Join(config.DataDir, historyFile),
+				config.BootHistorySize,
+				time.Duration(config.DefaultBootSeconds)*time.Second)
+			if err := bootHistory.load(); err != nil {
+				serverLog.Error(err, "Failed to load boot history, starting with empty history")
+			}
+
+			controller := &gcpController{
+				proxy:           p,
+				config:          serverConfig,
+				provider:        provider,
+				bootHistory:     bootHistory,
+				auditLog:        audit,
+				operations:      operations,
+				coordinator:     coord,
+				knownIPs:        make(map[string]knownIP),
+				flaggedSessions: make(map[string]bool),
+				waitingPlayers:  make(map[string]string),
+				log:             serverLog,
+				playerCount:     0,
+				lastActivity:    time.Now(),
+				lastStartTime:   time.Time{},
+				shutdownTimer:   nil,
+			}
+			controllers = append(controllers, controller)
+
+			// Operations requested before the last restart are resumed once all controllers are set up
+			for _, op := range operations.forServer(serverConfig.ServerAddress) {
+				if op.Kind == operationStart {
+					controller.pendingStart = true
+				}
+				if op.Lease {
+					controller.leaseOperations++
+				}
+			}
+			if dnsProvider != nil && serverConfig.DNS.Name != "" {
+				controller.dns = &dnsRecord{
+					provider: dnsProvider,
+					config:   serverConfig.DNS,
+					log:      serverLog.WithName("dns"),
+				}
+			}
+			if config.Readiness.ProbeIntervalSeconds > 0 {
+				controller.readyCache = newReadinessCache()
+				go controller.probeReadiness(ctx)
+			}
+			if config.ActivityStatus.Enabled {
+				controller.activityChanged = make(chan struct{}, 1)
+				go controller.writeActivityStatus(ctx)
+			}
+			if coord != nil {
+				coord.add(controller)
+			}
+
+			// Subscribe to events
+			event.Subscribe(p.Event(), 0, controller.onServerPreConnect)
+			event.Subscribe(p.Event(), 0, controller.onServerPostConnect)
+			event.Subscribe(p.Event(), 0, controller.onDisconnect)
+			if len(serverConfig.VirtualHosts) > 0 {
+				// Run after the default handlers, so forced hosts and other MOTD plugins are overridden
+				event.Subscribe(p.Event(), -1, controller.onChooseInitialServer)
+				event.Subscribe(p.Event(), -1, controller.onVirtualHostPing)
+			}
+			if config.Prewarm.OnLogin || config.Prewarm.OnPing {
+				event.Subscribe(p.Event(), 0, controller.onPostLogin)
+			}
+			if config.Prewarm.OnPing {
+				event.Subscribe(p.Event(), 0, controller.onPing)
+			}
+
+			serverLog.Info("Managing server",
+				"project", serverConfig.ProjectID,
+				"zone", serverConfig.Zone,
+				"instance", serverConfig.primaryInstance().name(),
+				"virtualHosts", serverConfig.VirtualHosts)
+		}
+
+		for _, controller := range controllers {
+			controller.servers = controllers
+		}
+		for _, controller := range controllers {
+			// Continue waiting for operations requested before the last restart
+			for _, op := range operations.forServer(controller.config.ServerAddress) {
+				controller.log.Info("Resuming pending operation",
+					"operation", op.Name,
+					"kind", op.Kind,
+					"instance", op.Instance.name())
+				go controller.resumeOperation(op)
+			}
+			if config.Prediction.Enabled {
+				go controller.predictStarts(ctx)
+			}
+		}
+
+		// Register commands
+		p.Command().Register(controllers[0].gcpCommand())
+		if config.PlayerCommands.ServerStatus {
+			p.Command().Register(controllers[0].serverStatusCommand())
+		}
+		if config.PlayerCommands.Extend {
+			p.Command().Register(controllers[0].extendCommand())
 		}
 
-		controller := &gcpController{
-			proxy:         p,
-			config:        config,
-			client:        client,
-			log:           log,
-			playerCount:   0,
-			lastActivity:  time.Now(),
-			lastStartTime: time.Time{},
-			shutdownTimer: nil,
+		if config.API.Enabled {
+			go controllers[0].serveAPI(ctx)
 		}
 
-		// Subscribe to events
-		event.Subscribe(p.Event(), 0, controller.onServerPreConnect)
-		event.Subscribe(p.Event(), 0, controller.onServerPostConnect)
-		event.Subscribe(p.Event(), 0, controller.onDisconnect)
+		if coord != nil {
+			go coord.run(ctx)
+			log.Info("Coordinating with other proxy replicas",
+				"replica", coord.id,
+				"backend", config.Coordination.Backend)
+		}
 
 		log.Info("GCP Controller plugin initialized successfully",
-			"project", config.ProjectID,
-			"zone", config.Zone,
-			"instance", config.InstanceName)
+			"provider", config.Provider,
+			"servers", len(controllers))
 
 		return nil
 	},
 }
 
 type gcpController struct {
-	proxy  *proxy.Proxy
-	config *Config
-	client *compute.InstancesClient
-	log    logr.Logger
+	proxy       *proxy.Proxy
+	config      *Config
+	provider    instanceProvider
+	bootHistory *bootHistory
+	auditLog    *auditLog
+	operations  *operationStore
+	coordinator *coordinator // nil unless coordination with other proxy replicas is enabled
+	log         logr.Logger
+
+	// Copies of playerCount and lastJoin (Unix nanoseconds) for the coordinator, which reads them
+	// without g.mu so heartbeats don't wait for a start or stop
+	sharedPlayers  atomic.Int64
+	sharedLastJoin atomic.Int64
 
 	mu                        sync.RWMutex
 	playerCount               int
 	lastActivity              time.Time
+	lastJoin                  time.Time
 	lastStartTime             time.Time
 	shutdownTimer             *time.Timer
+	shutdownAt                time.Time
 	noJoinSafetyTimer         *time.Timer
+	safetyShutdownAt          time.Time
 	hasPlayerJoinedSinceStart bool
 	isStarting                bool
+	bootStartedAt             time.Time         // when the start of the current boot was requested
+	activeInstance            int               // index into config.instances() of the instance serving the server entry
+	primaryAddress            string            // address of the server entry as configured in config.servers
+	routePending              bool              // the server entry could not be pointed at the started instance yet
+	pendingStart              bool              // a start operation is awaited in the background
+	leaseOperations           int               // operations awaited in the background that hold the coordination lease
+	transitioning             bool              // a start, stop or recovery is waiting with g.mu released
+	lastStatus                string            // status of the instance when it was last checked
+	startedProfile            string            // start profile the instance was last started with
+	speculativeStart          bool              // the instance was started ahead of a predicted session and nobody joined yet
+	watchdogAttempts          int               // recoveries of the current boot by the watchdog
+	watchdogGaveUp            bool              // the watchdog reached maxAttempts for the current boot
+	waitingPlayers            map[string]string // UUID -> name of players who tried to join during the boot
+	sessionStartedAt          time.Time         // first join since the start, for the sessionScaled idle policy
+	flaggedSessions           map[string]bool   // UUIDs of players whose session an operator flagged
+	flaggedSessionEnded       bool              // the last flagged session ended, for the operatorSession idle policy
+	servers                   []*gcpController  // controllers of all managed servers, for commands
+	extendDay                 string            // day the /extend counters below belong to
+	extendsByPlayer           map[string]int    // UUID -> uses of /extend on extendDay
+	extendsToday              int               // uses of /extend by all players on extendDay
+	lastPrewarm               time.Time
+	knownIPs                  map[string]knownIP // IP -> whitelisted player who recently logged in from it
+	activityChanged           chan struct{}      // nil unless the activity status is written to the instance
+	dns                       *dnsRecord         // nil unless a DNS record follows the instance
+	readyCache                *readinessCache    // nil unless the server is probed in the background
 }
 
 // Config holds the GCP controller configuration
@@ -87,12 +253,131 @@ type Config struct {
 	ProjectID               string
 	Zone                    string
 	InstanceName            string
+	InstanceGroup           string // managed instance group to resize instead of starting InstanceName
 	ServerAddress           string
 	IdleTimeoutMinutes      int
 	StartupThresholdMinutes int
 	NoJoinTimeoutMinutes    int
-	StartingMessage         string
+	StartingMessage         string // same as Messages.StartRequested, kept for existing configs
+	Messages                MessagesConfig
 	CredentialsPath         string
+	Auth                    AuthConfig
+	Provider                string
+	Simulated               SimulatedConfig
+	FallbackInstances       []InstanceConfig
+	AddressSource           string
+	DataDir                 string
+	BootHistorySize         int
+	DefaultBootSeconds      int
+	Readiness               ReadinessConfig
+	AuditLogPath            string
+	Operators               []string // List of operator UUIDs allowed to use /gcp
+	IdlePolicies            []IdlePolicyConfig
+	idlePolicies            []idlePolicy // created from IdlePolicies
+	Prewarm                 PrewarmConfig
+	Coordination            CoordinationConfig
+	ActivityStatus          ActivityStatusConfig
+	Report                  ReportConfig
+	API                     APIConfig
+	PlayerCommands          PlayerCommandsConfig
+	Hooks                   HooksConfig
+	Watchdog                WatchdogConfig
+	Console                 ConsoleConfig
+	Prediction              PredictionConfig
+	DNS                     DNSConfig
+	StartProfiles           []StartProfileConfig
+	StartProfile            string // start profile used unless a virtual host or /gcp start selects another
+	VirtualHosts            []string
+	Motd                    string
+	ManagedServers          []ManagedServerConfig
+}
+
+// ManagedServerConfig configures an additional managed server with its own instance.
+// Settings not listed here are shared with the top-level managed server.
+type ManagedServerConfig struct {
+	ServerAddress     string           `mapstructure:"serverAddress"`
+	ProjectID         string           `mapstructure:"projectId"`
+	Zone              string           `mapstructure:"zone"`
+	InstanceName      string           `mapstructure:"instanceName"`
+	InstanceGroup     string           `mapstructure:"instanceGroup"`
+	FallbackInstances []InstanceConfig `mapstructure:"fallbackInstances"`
+	VirtualHosts      []string         `mapstructure:"virtualHosts"`
+	StartingMessage   string           `mapstructure:"startingMessage"`
+	Messages          MessagesConfig   `mapstructure:"messages"`
+	Motd              string           `mapstructure:"motd"`
+	StartProfile      string           `mapstructure:"startProfile"`
+	DNSName           string           `mapstructure:"dnsName"`
+}
+
+// InstanceConfig identifies a Compute Engine instance that can host the managed server
+type InstanceConfig struct {
+	ProjectID    string `mapstructure:"projectId"`
+	Zone         string `mapstructure:"zone"`
+	InstanceName string `mapstructure:"instanceName"`
+	// InstanceGroup is a zonal managed instance group holding at most one instance. If set,
+	// the group is scaled instead of starting and stopping InstanceName.
+	InstanceGroup string `mapstructure:"instanceGroup"`
+	// Address is the backend address (host:port) of the game server on this instance.
+	// If empty, the address configured in config.servers is used. With an addressSource
+	// only the port is used, the host is replaced by the instance's current IP.
+	Address string `mapstructure:"address"`
+}
+
+// key returns a unique identifier of the instance
+func (i InstanceConfig) key() string {
+	if i.InstanceGroup != "" {
+		return i.ProjectID + "/" + i.Zone + "/group/" + i.InstanceGroup
+	}
+	return i.ProjectID + "/" + i.Zone + "/" + i.InstanceName
+}
+
+// name returns the instance name, or the instance group name for managed instance groups
+func (i InstanceConfig) name() string {
+	if i.InstanceGroup != "" {
+		return i.InstanceGroup
+	}
+	return i.InstanceName
+}
+
+// primaryInstance returns the instance configured by projectId, zone and instanceName
+func (cfg *Config) primaryInstance() InstanceConfig {
+	return InstanceConfig{
+		ProjectID:     cfg.ProjectID,
+		Zone:          cfg.Zone,
+		InstanceName:  cfg.InstanceName,
+		InstanceGroup: cfg.InstanceGroup,
+	}
+}
+
+// instances returns the primary instance followed by the fallback instances in the order they are tried
+func (cfg *Config) instances() []InstanceConfig {
+	return append([]InstanceConfig{cfg.primaryInstance()}, cfg.FallbackInstances...)
+}
+
+// servers returns the configuration of every managed server, starting with the top-level one
+func (cfg *Config) servers() []*Config {
+	servers := []*Config{cfg}
+	for _, managed := range cfg.ManagedServers {
+		server := *cfg
+		server.ManagedServers = nil
+		server.ServerAddress = managed.ServerAddress
+		server.ProjectID = managed.ProjectID
+		server.Zone = managed.Zone
+		server.InstanceName = managed.InstanceName
+		server.InstanceGroup = managed.InstanceGroup
+		server.FallbackInstances = managed.FallbackInstances
+		server.VirtualHosts = managed.VirtualHosts
+		server.Motd = managed.Motd
+		server.StartProfile = managed.StartProfile
+		server.DNS.Name = normalizeDNSName(managed.DNSName)
+		server.Messages = cfg.Messages.override(managed.Messages)
+		if managed.StartingMessage != "" && managed.Messages.StartRequested == "" {
+			server.StartingMessage = managed.StartingMessage
+			server.Messages.StartRequested = managed.StartingMessage
+		}
+		servers = append(servers, &server)
+	}
+	return servers
 }
 
 // loadConfig loads the GCP controller configuration from config.yml
@@ -101,7 +386,72 @@ func loadConfig(_ *proxy.Proxy) (*Config, error) {
 		IdleTimeoutMinutes:      30,
 		StartupThresholdMinutes: 5,
 		NoJoinTimeoutMinutes:    15,
-		StartingMessage:         "Server is starting up! Please wait 30-60 seconds and try again.",
+		StartingMessage:         "&eServer is starting up! &7Please wait about &f{eta}&7 and try again.",
+		Provider:                providerGCP,
+		DataDir:                 "gcp-data",
+		BootHistorySize:         10,
+		DefaultBootSeconds:      60,
+		Messages: MessagesConfig{
+			Format:           messageFormatLegacy,
+			AlreadyStarting:  "&e{server} is already starting &7({status}). Please wait about &f{eta}&7 and try again.",
+			StartFailed:      "&cThe server could not be started. &7Please try again later or contact an operator.",
+			StartingCooldown: "&eThe server was started {elapsed} ago and is still booting. &7Please wait about &f{eta}&7.",
+			Recovering:       "&eThe server did not come up and is being restarted. &7Please wait about &f{eta}&7 and try again.",
+		},
+		Watchdog: WatchdogConfig{
+			TimeoutMinutes: 5,
+			Action:         watchdogReset,
+			MaxAttempts:    2,
+		},
+		Auth: AuthConfig{
+			SelfCheck: true,
+		},
+		Console: ConsoleConfig{
+			CaptureLines: 50,
+		},
+		Prediction: PredictionConfig{
+			LeadMinutes:           10,
+			Threshold:             0.5,
+			LookbackWeeks:         8,
+			MinWeeks:              2,
+			MaxSpeculativeMinutes: 30,
+		},
+		Prewarm: PrewarmConfig{
+			PingMemoryHours:  24,
+			WhitelistEnabled: true,
+			WhitelistFile:    "whitelist.json",
+		},
+		Coordination: CoordinationConfig{
+			Backend:          coordinationFile,
+			HeartbeatSeconds: 10,
+			StaleSeconds:     30,
+			LeaseSeconds:     300,
+		},
+		ActivityStatus: ActivityStatusConfig{
+			Target:             activityTargetLabels,
+			Prefix:             "gate-",
+			MinIntervalSeconds: 60,
+		},
+		API: APIConfig{
+			Bind: "127.0.0.1:8081",
+		},
+		PlayerCommands: PlayerCommandsConfig{
+			ServerStatus:        true,
+			ExtendMinutes:       15,
+			MaxExtendsPerPlayer: 2,
+		},
+		Readiness: ReadinessConfig{
+			Source:                       readinessNetwork,
+			Value:                        "true",
+			ProbeIntervalSeconds:         10,
+			StartingProbeIntervalSeconds: 2,
+			MaxAgeSeconds:                30,
+		},
+		Simulated: SimulatedConfig{
+			BootDelaySeconds:     30,
+			ShutdownDelaySeconds: 10,
+			InitialStatus:        statusTerminated,
+		},
 	}
 
 	// Create a new viper instance to read the config.yml file
@@ -125,12 +475,36 @@ func loadConfig(_ *proxy.Proxy) (*Config, error) {
 	if v.IsSet("gcpController.instanceName") {
 		cfg.InstanceName = v.GetString("gcpController.instanceName")
 	}
+	if v.IsSet("gcpController.instanceGroup") {
+		cfg.InstanceGroup = v.GetString("gcpController.instanceGroup")
+	}
 	if v.IsSet("gcpController.serverAddress") {
 		cfg.ServerAddress = v.GetString("gcpController.serverAddress")
 	}
 	if v.IsSet("gcpController.credentialsPath") {
 		cfg.CredentialsPath = v.GetString("gcpController.credentialsPath")
 	}
+	if v.IsSet("gcpController.auth.credentialsEnv") {
+		cfg.Auth.CredentialsEnv = v.GetString("gcpController.auth.credentialsEnv")
+	}
+	if v.IsSet("gcpController.auth.impersonateServiceAccount") {
+		cfg.Auth.ImpersonateServiceAccount = v.GetString("gcpController.auth.impersonateServiceAccount")
+	}
+	if v.IsSet("gcpController.auth.delegates") {
+		cfg.Auth.Delegates = v.GetStringSlice("gcpController.auth.delegates")
+	}
+	if v.IsSet("gcpController.auth.quotaProject") {
+		cfg.Auth.QuotaProject = v.GetString("gcpController.auth.quotaProject")
+	}
+	if v.IsSet("gcpController.auth.endpoint") {
+		cfg.Auth.Endpoint = v.GetString("gcpController.auth.endpoint")
+	}
+	if v.IsSet("gcpController.auth.withoutAuthentication") {
+		cfg.Auth.WithoutAuthentication = v.GetBool("gcpController.auth.withoutAuthentication")
+	}
+	if v.IsSet("gcpController.auth.selfCheck") {
+		cfg.Auth.SelfCheck = v.GetBool("gcpController.auth.selfCheck")
+	}
 	if v.IsSet("gcpController.idleTimeoutMinutes") {
 		cfg.IdleTimeoutMinutes = v.GetInt("gcpController.idleTimeoutMinutes")
 	}
@@ -143,24 +517,513 @@ func loadConfig(_ *proxy.Proxy) (*Config, error) {
 	if v.IsSet("gcpController.startingMessage") {
 		cfg.StartingMessage = v.GetString("gcpController.startingMessage")
 	}
+	if v.IsSet("gcpController.messages.format") {
+		cfg.Messages.Format = strings.ToLower(v.GetString("gcpController.messages.format"))
+	}
+	if v.IsSet("gcpController.messages.startRequested") {
+		cfg.Messages.StartRequested = v.GetString("gcpController.messages.startRequested")
+	}
+	if v.IsSet("gcpController.messages.alreadyStarting") {
+		cfg.Messages.AlreadyStarting = v.GetString("gcpController.messages.alreadyStarting")
+	}
+	if v.IsSet("gcpController.messages.startFailed") {
+		cfg.Messages.StartFailed = v.GetString("gcpController.messages.startFailed")
+	}
+	if v.IsSet("gcpController.messages.recovering") {
+		cfg.Messages.Recovering = v.GetString("gcpController.messages.recovering")
+	}
+	if v.IsSet("gcpController.messages.startingCooldown") {
+		cfg.Messages.StartingCooldown = v.GetString("gcpController.messages.startingCooldown")
+	}
+	if v.IsSet("gcpController.dataDir") {
+		cfg.DataDir = v.GetString("gcpController.dataDir")
+	}
+	if v.IsSet("gcpController.bootHistorySize") {
+		cfg.BootHistorySize = v.GetInt("gcpController.bootHistorySize")
+	}
+	if v.IsSet("gcpController.defaultBootSeconds") {
+		cfg.DefaultBootSeconds = v.GetInt("gcpController.defaultBootSeconds")
+	}
+	if v.IsSet("gcpController.auditLogPath") {
+		cfg.AuditLogPath = v.GetString("gcpController.auditLogPath")
+	}
+	if v.IsSet("gcpController.operators") {
+		cfg.Operators = v.GetStringSlice("gcpController.operators")
+	} else {
+		// Share the operators of the whitelist plugin by default
+		cfg.Operators = v.GetStringSlice("whitelist.operators")
+	}
+	if v.IsSet("gcpController.prewarm.onLogin") {
+		cfg.Prewarm.OnLogin = v.GetBool("gcpController.prewarm.onLogin")
+	}
+	if v.IsSet("gcpController.prewarm.onPing") {
+		cfg.Prewarm.OnPing = v.GetBool("gcpController.prewarm.onPing")
+	}
+	if v.IsSet("gcpController.prewarm.pingMemoryHours") {
+		cfg.Prewarm.PingMemoryHours = v.GetInt("gcpController.prewarm.pingMemoryHours")
+	}
+	if v.IsSet("whitelist.enabled") {
+		cfg.Prewarm.WhitelistEnabled = v.GetBool("whitelist.enabled")
+	}
+	if v.IsSet("whitelist.whitelistFile") {
+		cfg.Prewarm.WhitelistFile = v.GetString("whitelist.whitelistFile")
+	}
+	if v.IsSet("gcpController.coordination.enabled") {
+		cfg.Coordination.Enabled = v.GetBool("gcpController.coordination.enabled")
+	}
+	if v.IsSet("gcpController.coordination.backend") {
+		cfg.Coordination.Backend = strings.ToLower(v.GetString("gcpController.coordination.backend"))
+	}
+	if v.IsSet("gcpController.coordination.path") {
+		cfg.Coordination.Path = v.GetString("gcpController.coordination.path")
+	}
+	if v.IsSet("gcpController.coordination.replicaId") {
+		cfg.Coordination.ReplicaID = v.GetString("gcpController.coordination.replicaId")
+	}
+	if v.IsSet("gcpController.coordination.heartbeatSeconds") {
+		cfg.Coordination.HeartbeatSeconds = v.GetInt("gcpController.coordination.heartbeatSeconds")
+	}
+	if v.IsSet("gcpController.coordination.staleSeconds") {
+		cfg.Coordination.StaleSeconds = v.GetInt("gcpController.coordination.staleSeconds")
+	}
+	if v.IsSet("gcpController.coordination.leaseSeconds") {
+		cfg.Coordination.LeaseSeconds = v.GetInt("gcpController.coordination.leaseSeconds")
+	}
+	if v.IsSet("gcpController.activityStatus.enabled") {
+		cfg.ActivityStatus.Enabled = v.GetBool("gcpController.activityStatus.enabled")
+	}
+	if v.IsSet("gcpController.activityStatus.target") {
+		cfg.ActivityStatus.Target = strings.ToLower(v.GetString("gcpController.activityStatus.target"))
+	}
+	if v.IsSet("gcpController.activityStatus.prefix") {
+		cfg.ActivityStatus.Prefix = v.GetString("gcpController.activityStatus.prefix")
+	}
+	if v.IsSet("gcpController.activityStatus.minIntervalSeconds") {
+		cfg.ActivityStatus.MinIntervalSeconds = v.GetInt("gcpController.activityStatus.minIntervalSeconds")
+	}
+	if v.IsSet("gcpController.report.hourlyPrice") {
+		cfg.Report.HourlyPrice = v.GetFloat64("gcpController.report.hourlyPrice")
+	}
+	if v.IsSet("gcpController.report.currency") {
+		cfg.Report.Currency = v.GetString("gcpController.report.currency")
+	}
+	if v.IsSet("gcpController.api.enabled") {
+		cfg.API.Enabled = v.GetBool("gcpController.api.enabled")
+	}
+	if v.IsSet("gcpController.api.bind") {
+		cfg.API.Bind = v.GetString("gcpController.api.bind")
+	}
+	if v.IsSet("gcpController.api.token") {
+		cfg.API.Token = v.GetString("gcpController.api.token")
+	}
+	if v.IsSet("gcpController.playerCommands.serverStatus") {
+		cfg.PlayerCommands.ServerStatus = v.GetBool("gcpController.playerCommands.serverStatus")
+	}
+	if v.IsSet("gcpController.playerCommands.extend") {
+		cfg.PlayerCommands.Extend = v.GetBool("gcpController.playerCommands.extend")
+	}
+	if v.IsSet("gcpController.playerCommands.extendMinutes") {
+		cfg.PlayerCommands.ExtendMinutes = v.GetInt("gcpController.playerCommands.extendMinutes")
+	}
+	if v.IsSet("gcpController.playerCommands.maxExtendsPerPlayer") {
+		cfg.PlayerCommands.MaxExtendsPerPlayer = v.GetInt("gcpController.playerCommands.maxExtendsPerPlayer")
+	}
+	if v.IsSet("gcpController.playerCommands.maxExtendsPerDay") {
+		cfg.PlayerCommands.MaxExtendsPerDay = v.GetInt("gcpController.playerCommands.maxExtendsPerDay")
+	}
+	if v.IsSet("gcpController.watchdog.enabled") {
+		cfg.Watchdog.Enabled = v.GetBool("gcpController.watchdog.enabled")
+	}
+	if v.IsSet("gcpController.watchdog.timeoutMinutes") {
+		cfg.Watchdog.TimeoutMinutes = v.GetInt("gcpController.watchdog.timeoutMinutes")
+	}
+	if v.IsSet("gcpController.watchdog.action") {
+		cfg.Watchdog.Action = strings.ToLower(v.GetString("gcpController.watchdog.action"))
+	}
+	if v.IsSet("gcpController.watchdog.maxAttempts") {
+		cfg.Watchdog.MaxAttempts = v.GetInt("gcpController.watchdog.maxAttempts")
+	}
+	if v.IsSet("gcpController.console.captureLines") {
+		cfg.Console.CaptureLines = v.GetInt("gcpController.console.captureLines")
+	}
+	if v.IsSet("gcpController.prediction.enabled") {
+		cfg.Prediction.Enabled = v.GetBool("gcpController.prediction.enabled")
+	}
+	if v.IsSet("gcpController.prediction.leadMinutes") {
+		cfg.Prediction.LeadMinutes = v.GetInt("gcpController.prediction.leadMinutes")
+	}
+	if v.IsSet("gcpController.prediction.threshold") {
+		cfg.Prediction.Threshold = v.GetFloat64("gcpController.prediction.threshold")
+	}
+	if v.IsSet("gcpController.prediction.lookbackWeeks") {
+		cfg.Prediction.LookbackWeeks = v.GetInt("gcpController.prediction.lookbackWeeks")
+	}
+	if v.IsSet("gcpController.prediction.minWeeks") {
+		cfg.Prediction.MinWeeks = v.GetInt("gcpController.prediction.minWeeks")
+	}
+	if v.IsSet("gcpController.prediction.maxSpeculativeMinutes") {
+		cfg.Prediction.MaxSpeculativeMinutes = v.GetInt("gcpController.prediction.maxSpeculativeMinutes")
+	}
+	if v.IsSet("gcpController.prediction.timezone") {
+		cfg.Prediction.Timezone = v.GetString("gcpController.prediction.timezone")
+	}
+	if v.IsSet("gcpController.dns.provider") {
+		cfg.DNS.Provider = v.GetString("gcpController.dns.provider")
+	}
+	if v.IsSet("gcpController.dns.name") {
+		cfg.DNS.Name = v.GetString("gcpController.dns.name")
+	}
+	if v.IsSet("gcpController.dns.ttl") {
+		cfg.DNS.TTL = v.GetInt("gcpController.dns.ttl")
+	}
+	if v.IsSet("gcpController.dns.addressSource") {
+		cfg.DNS.AddressSource = strings.ToLower(v.GetString("gcpController.dns.addressSource"))
+	}
+	if v.IsSet("gcpController.dns.onStop") {
+		cfg.DNS.OnStop = strings.ToLower(v.GetString("gcpController.dns.onStop"))
+	}
+	if v.IsSet("gcpController.dns.parkIP") {
+		cfg.DNS.ParkIP = v.GetString("gcpController.dns.parkIP")
+	}
+	if v.IsSet("gcpController.dns.cloudDNS.project") {
+		cfg.DNS.CloudDNS.Project = v.GetString("gcpController.dns.cloudDNS.project")
+	}
+	if v.IsSet("gcpController.dns.cloudDNS.managedZone") {
+		cfg.DNS.CloudDNS.ManagedZone = v.GetString("gcpController.dns.cloudDNS.managedZone")
+	}
+	if v.IsSet("gcpController.dns.http.url") {
+		cfg.DNS.HTTP.URL = v.GetString("gcpController.dns.http.url")
+	}
+	if v.IsSet("gcpController.dns.http.method") {
+		cfg.DNS.HTTP.Method = strings.ToUpper(v.GetString("gcpController.dns.http.method"))
+	}
+	if v.IsSet("gcpController.dns.http.headers") {
+		cfg.DNS.HTTP.Headers = v.GetStringSlice("gcpController.dns.http.headers")
+	}
+	if v.IsSet("gcpController.dns.http.body") {
+		cfg.DNS.HTTP.Body = v.GetString("gcpController.dns.http.body")
+	}
+	if v.IsSet("gcpController.readiness.source") {
+		cfg.Readiness.Source = canonicalReadinessSource(v.GetString("gcpController.readiness.source"))
+	}
+	if v.IsSet("gcpController.readiness.key") {
+		cfg.Readiness.Key = v.GetString("gcpController.readiness.key")
+	}
+	if v.IsSet("gcpController.readiness.value") {
+		cfg.Readiness.Value = v.GetString("gcpController.readiness.value")
+	}
+	if v.IsSet("gcpController.readiness.probeIntervalSeconds") {
+		cfg.Readiness.ProbeIntervalSeconds = v.GetInt("gcpController.readiness.probeIntervalSeconds")
+	}
+	if v.IsSet("gcpController.readiness.startingProbeIntervalSeconds") {
+		cfg.Readiness.StartingProbeIntervalSeconds = v.GetInt("gcpController.readiness.startingProbeIntervalSeconds")
+	}
+	if v.IsSet("gcpController.readiness.maxAgeSeconds") {
+		cfg.Readiness.MaxAgeSeconds = v.GetInt("gcpController.readiness.maxAgeSeconds")
+	}
+	if v.IsSet("gcpController.provider") {
+		cfg.Provider = strings.ToLower(v.GetString("gcpController.provider"))
+	}
+	if v.IsSet("gcpController.simulated.bootDelaySeconds") {
+		cfg.Simulated.BootDelaySeconds = v.GetInt("gcpController.simulated.bootDelaySeconds")
+	}
+	if v.IsSet("gcpController.simulated.shutdownDelaySeconds") {
+		cfg.Simulated.ShutdownDelaySeconds = v.GetInt("gcpController.simulated.shutdownDelaySeconds")
+	}
+	if v.IsSet("gcpController.simulated.startFailureRate") {
+		cfg.Simulated.StartFailureRate = v.GetFloat64("gcpController.simulated.startFailureRate")
+	}
+	if v.IsSet("gcpController.simulated.stopFailureRate") {
+		cfg.Simulated.StopFailureRate = v.GetFloat64("gcpController.simulated.stopFailureRate")
+	}
+	if v.IsSet("gcpController.simulated.initialStatus") {
+		cfg.Simulated.InitialStatus = strings.ToUpper(v.GetString("gcpController.simulated.initialStatus"))
+	}
+	if v.IsSet("gcpController.simulated.exhaustedZones") {
+		cfg.Simulated.ExhaustedZones = v.GetStringSlice("gcpController.simulated.exhaustedZones")
+	}
+	if v.IsSet("gcpController.addressSource") {
+		cfg.AddressSource = strings.ToLower(v.GetString("gcpController.addressSource"))
+	}
+	if v.IsSet("gcpController.virtualHosts") {
+		cfg.VirtualHosts = v.GetStringSlice("gcpController.virtualHosts")
+	}
+	if v.IsSet("gcpController.motd") {
+		cfg.Motd = v.GetString("gcpController.motd")
+	}
+	if v.IsSet("gcpController.managedServers") {
+		if err := v.UnmarshalKey("gcpController.managedServers", &cfg.ManagedServers); err != nil {
+			return nil, fmt.Errorf("failed to parse gcpController.managedServers: %w", err)
+		}
+	}
+	if v.IsSet("gcpController.idlePolicies") {
+		if err := v.UnmarshalKey("gcpController.idlePolicies", &cfg.IdlePolicies); err != nil {
+			return nil, fmt.Errorf("failed to parse gcpController.idlePolicies: %w", err)
+		}
+	}
+	if v.IsSet("gcpController.startProfile") {
+		cfg.StartProfile = v.GetString("gcpController.startProfile")
+	}
+	if v.IsSet("gcpController.startProfiles") {
+		if err := v.UnmarshalKey("gcpController.startProfiles", &cfg.StartProfiles); err != nil {
+			return nil, fmt.Errorf("failed to parse gcpController.startProfiles: %w", err)
+		}
+	}
+	if v.IsSet("gcpController.hooks") {
+		if err := v.UnmarshalKey("gcpController.hooks", &cfg.Hooks); err != nil {
+			return nil, fmt.Errorf("failed to parse gcpController.hooks: %w", err)
+		}
+	}
+	if v.IsSet("gcpController.fallbackInstances") {
+		if err := v.UnmarshalKey("gcpController.fallbackInstances", &cfg.FallbackInstances); err != nil {
+			return nil, fmt.Errorf("failed to parse gcpController.fallbackInstances: %w", err)
+		}
+	}
 
 	// Validate required fields
-	if cfg.ProjectID == "" {
-		return nil, fmt.Errorf("gcpController.projectId is required in config.yml")
-	}
-	if cfg.Zone == "" {
-		return nil, fmt.Errorf("gcpController.zone is required in config.yml")
+	switch cfg.Provider {
+	case providerGCP:
+		if cfg.ProjectID == "" {
+			return nil, fmt.Errorf("gcpController.projectId is required in config.yml")
+		}
+		if cfg.Zone == "" {
+			return nil, fmt.Errorf("gcpController.zone is required in config.yml")
+		}
+		if cfg.InstanceName == "" && cfg.InstanceGroup == "" {
+			return nil, fmt.Errorf("gcpController.instanceName or gcpController.instanceGroup is required in config.yml")
+		}
+	case providerSimulated:
+		if cfg.Simulated.InitialStatus != statusRunning && cfg.Simulated.InitialStatus != statusTerminated {
+			return nil, fmt.Errorf("gcpController.simulated.initialStatus must be %s or %s", statusRunning, statusTerminated)
+		}
+		if cfg.Simulated.StartFailureRate < 0 || cfg.Simulated.StartFailureRate > 1 {
+			return nil, fmt.Errorf("gcpController.simulated.startFailureRate must be between 0 and 1")
+		}
+		if cfg.Simulated.StopFailureRate < 0 || cfg.Simulated.StopFailureRate > 1 {
+			return nil, fmt.Errorf("gcpController.simulated.stopFailureRate must be between 0 and 1")
+		}
+	default:
+		return nil, fmt.Errorf("gcpController.provider must be %q or %q, got %q", providerGCP, providerSimulated, cfg.Provider)
 	}
-	if cfg.InstanceName == "" {
-		return nil, fmt.Errorf("gcpController.instanceName is required in config.yml")
+	if cfg.InstanceName != "" && cfg.InstanceGroup != "" {
+		return nil, fmt.Errorf("gcpController.instanceName and gcpController.instanceGroup can't be used together")
 	}
 	if cfg.ServerAddress == "" {
 		return nil, fmt.Errorf("gcpController.serverAddress is required in config.yml")
 	}
+	if cfg.AuditLogPath == "" {
+		cfg.AuditLogPath = filepath.Join(cfg.DataDir, "audit.jsonl")
+	}
+	if cfg.BootHistorySize < 1 {
+		return nil, fmt.Errorf("gcpController.bootHistorySize must be at least 1")
+	}
+	switch cfg.Readiness.Source {
+	case readinessNetwork:
+	case readinessGuestAttribute, readinessMetadata:
+		if cfg.Readiness.Key == "" {
+			return nil, fmt.Errorf("gcpController.readiness.key is required for readiness source %q", cfg.Readiness.Source)
+		}
+	default:
+		return nil, fmt.Errorf("gcpController.readiness.source must be %q, %q or %q, got %q",
+			readinessNetwork, readinessGuestAttribute, readinessMetadata, cfg.Readiness.Source)
+	}
+	if cfg.Readiness.ProbeIntervalSeconds < 0 {
+		return nil, fmt.Errorf("gcpController.readiness.probeIntervalSeconds must not be negative")
+	}
+	if cfg.Readiness.ProbeIntervalSeconds > 0 {
+		if cfg.Readiness.StartingProbeIntervalSeconds < 1 {
+			return nil, fmt.Errorf("gcpController.readiness.startingProbeIntervalSeconds must be at least 1")
+		}
+		if cfg.Readiness.MaxAgeSeconds < 1 {
+			return nil, fmt.Errorf("gcpController.readiness.maxAgeSeconds must be at least 1")
+		}
+	}
+	switch cfg.AddressSource {
+	case "", addressSourceInternal, addressSourceExternal:
+	default:
+		return nil, fmt.Errorf("gcpController.addressSource must be %q or %q, got %q",
+			addressSourceInternal, addressSourceExternal, cfg.AddressSource)
+	}
+	if cfg.Coordination.Enabled {
+		if cfg.Coordination.Backend != coordinationFile {
+			return nil, fmt.Errorf("gcpController.coordination.backend must be %q, got %q",
+				coordinationFile, cfg.Coordination.Backend)
+		}
+		if cfg.Coordination.Path == "" {
+			cfg.Coordination.Path = filepath.Join(cfg.DataDir, "replicas")
+		}
+		if cfg.Coordination.HeartbeatSeconds < 1 {
+			return nil, fmt.Errorf("gcpController.coordination.heartbeatSeconds must be at least 1")
+		}
+		if cfg.Coordination.StaleSeconds <= cfg.Coordination.HeartbeatSeconds {
+			return nil, fmt.Errorf("gcpController.coordination.staleSeconds must be greater than heartbeatSeconds")
+		}
+		if cfg.Coordination.LeaseSeconds < 1 {
+			return nil, fmt.Errorf("gcpController.coordination.leaseSeconds must be at least 1")
+		}
+	}
+	switch cfg.ActivityStatus.Target {
+	case activityTargetLabels:
+		if cfg.ActivityStatus.Prefix == "" || !labelKeyPattern.MatchString(cfg.ActivityStatus.Prefix) {
+			return nil, fmt.Errorf("gcpController.activityStatus.prefix must start with a lowercase letter and " +
+				"only contain lowercase letters, digits, '-' and '_' when writing labels")
+		}
+	case activityTargetMetadata:
+	default:
+		return nil, fmt.Errorf("gcpController.activityStatus.target must be %q or %q, got %q",
+			activityTargetLabels, activityTargetMetadata, cfg.ActivityStatus.Target)
+	}
+	if cfg.ActivityStatus.MinIntervalSeconds < 1 {
+		return nil, fmt.Errorf("gcpController.activityStatus.minIntervalSeconds must be at least 1")
+	}
+	if cfg.IdleTimeoutMinutes < 0 {
+		return nil, fmt.Errorf("gcpController.idleTimeoutMinutes must not be negative")
+	}
+	idlePolicies, err := newIdlePolicies(cfg.IdlePolicies)
+	if err != nil {
+		return nil, err
+	}
+	cfg.idlePolicies = idlePolicies
+	if cfg.Messages.StartRequested == "" {
+		cfg.Messages.StartRequested = cfg.StartingMessage
+	}
+	if err := validateMessageFormat("gcpController.messages.format", cfg.Messages.Format); err != nil {
+		return nil, err
+	}
+	if cfg.Report.HourlyPrice < 0 {
+		return nil, fmt.Errorf("gcpController.report.hourlyPrice must not be negative")
+	}
+	if cfg.API.Enabled && cfg.API.Bind == "" {
+		return nil, fmt.Errorf("gcpController.api.bind is required when the API is enabled")
+	}
+	if err := cfg.Hooks.validate(); err != nil {
+		return nil, err
+	}
+	if err := validateStartProfiles(cfg.StartProfiles); err != nil {
+		return nil, err
+	}
+	if cfg.Watchdog.Enabled {
+		if cfg.Watchdog.Action != watchdogReset && cfg.Watchdog.Action != watchdogRestart {
+			return nil, fmt.Errorf("gcpController.watchdog.action must be %q or %q, got %q",
+				watchdogReset, watchdogRestart, cfg.Watchdog.Action)
+		}
+		if limit := int(bootWatchTimeout.Minutes()); cfg.Watchdog.TimeoutMinutes < 1 || cfg.Watchdog.TimeoutMinutes >= limit {
+			return nil, fmt.Errorf("gcpController.watchdog.timeoutMinutes must be between 1 and %d", limit-1)
+		}
+		if cfg.Watchdog.MaxAttempts < 1 {
+			return nil, fmt.Errorf("gcpController.watchdog.maxAttempts must be at least 1")
+		}
+	}
+	if err := cfg.Auth.validate(cfg.CredentialsPath); err != nil {
+		return nil, err
+	}
+	if err := cfg.DNS.validate(cfg.ProjectID); err != nil {
+		return nil, err
+	}
+	if err := cfg.Prediction.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Console.CaptureLines < 0 || cfg.Console.CaptureLines > maxConsoleLines {
+		return nil, fmt.Errorf("gcpController.console.captureLines must be between 0 and %d", maxConsoleLines)
+	}
+	if cfg.PlayerCommands.Extend && cfg.PlayerCommands.ExtendMinutes < 1 {
+		return nil, fmt.Errorf("gcpController.playerCommands.extendMinutes must be at least 1")
+	}
+	if cfg.PlayerCommands.MaxExtendsPerPlayer < 0 || cfg.PlayerCommands.MaxExtendsPerDay < 0 {
+		return nil, fmt.Errorf("gcpController.playerCommands.maxExtendsPerPlayer and maxExtendsPerDay must not be negative")
+	}
+	if err := normalizeFallbacks("gcpController.fallbackInstances", cfg.FallbackInstances, cfg.ProjectID); err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{cfg.ServerAddress: true}
+	for i := range cfg.ManagedServers {
+		managed := &cfg.ManagedServers[i]
+		prefix := fmt.Sprintf("gcpController.managedServers[%d]", i)
+
+		if managed.ServerAddress == "" {
+			return nil, fmt.Errorf("%s.serverAddress is required", prefix)
+		}
+		if names[managed.ServerAddress] {
+			return nil, fmt.Errorf("%s.serverAddress %q is managed more than once", prefix, managed.ServerAddress)
+		}
+		names[managed.ServerAddress] = true
+
+		if managed.ProjectID == "" {
+			managed.ProjectID = cfg.ProjectID
+		}
+		if err := validateTarget(prefix, managed.Zone, managed.InstanceName, managed.InstanceGroup); err != nil {
+			return nil, err
+		}
+		if err := normalizeFallbacks(prefix+".fallbackInstances", managed.FallbackInstances, managed.ProjectID); err != nil {
+			return nil, err
+		}
+		managed.Messages.Format = strings.ToLower(managed.Messages.Format)
+		if managed.Messages.Format != "" {
+			if err := validateMessageFormat(prefix+".messages.format", managed.Messages.Format); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, server := range cfg.servers() {
+		if err := server.validateMessages(); err != nil {
+			return nil, err
+		}
+		for i, host := range server.VirtualHosts {
+			server.VirtualHosts[i] = normalizeHost(host)
+		}
+		if server.StartProfile != "" && !slices.ContainsFunc(cfg.StartProfiles, func(p StartProfileConfig) bool {
+			return p.Name == server.StartProfile
+		}) {
+			return nil, fmt.Errorf("start profile %q of server %s is not configured in gcpController.startProfiles",
+				server.StartProfile, server.ServerAddress)
+		}
+
+		// Instance groups create instances with new IPs, so the address has to follow them
+		for _, inst := range server.instances() {
+			if inst.InstanceGroup != "" && cfg.AddressSource == "" {
+				cfg.AddressSource = addressSourceInternal
+			}
+		}
+	}
+	if err := validateGroupProfiles(cfg.servers(), cfg.StartProfiles); err != nil {
+		return nil, err
+	}
 
 	return cfg, nil
 }
 
+// validateTarget checks that an instance is identified by a zone and either an instance name or group
+func validateTarget(key, zone, instanceName, instanceGroup string) error {
+	if zone == "" || (instanceName == "") == (instanceGroup == "") {
+		return fmt.Errorf("%s requires zone and either instanceName or instanceGroup", key)
+	}
+	return nil
+}
+
+// validateMessageFormat checks that a message format is supported
+func validateMessageFormat(key, format string) error {
+	if format != messageFormatLegacy && format != messageFormatMini {
+		return fmt.Errorf("%s must be %q or %q, got %q", key, messageFormatLegacy, messageFormatMini, format)
+	}
+	return nil
+}
+
+// normalizeFallbacks validates fallback instances and defaults their project to projectID
+func normalizeFallbacks(key string, fallbacks []InstanceConfig, projectID string) error {
+	for i := range fallbacks {
+		fallback := &fallbacks[i]
+		if fallback.ProjectID == "" {
+			fallback.ProjectID = projectID
+		}
+		if err := validateTarget(fmt.Sprintf("%s[%d]", key, i), fallback.Zone, fallback.InstanceName, fallback.InstanceGroup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // onServerPreConnect handles player connection attempts before they connect to a server
 func (g *gcpController) onServerPreConnect(e *proxy.ServerPreConnectEvent) {
 	// Skip if event already denied by another plugin (e.g., whitelist)
@@ -174,28 +1037,52 @@ func (g *gcpController) onServerPreConnect(e *proxy.ServerPreConnectEvent) {
 		return
 	}
 
-	// Check if server is reachable
-	if g.isServerReachable(server) {
-		g.log.V(1).Info("Server is reachable, allowing connection",
-			"player", e.Player().Username(),
-			"server", server.ServerInfo().Name())
+	allowed, outcome := g.admitPlayer(e.Player().Context(), server, trigger{
+		Player:   e.Player().Username(),
+		PlayerID: e.Player().ID().String(),
+		Reason:   "player_connect",
+		Profile:  g.virtualHostProfile(e.Player().VirtualHost()),
+	})
+	if allowed {
 		return
 	}
 
-	// Server is not reachable, attempt to start it
-	g.log.Info("Server is not reachable, attempting to start GCP instance",
-		"player", e.Player().Username(),
+	// Deny connection and kick player with the message for what happened
+	e.Deny()
+	e.Player().Disconnect(g.formatMessage(g.config.Messages.forOutcome(outcome), e.Player().Username()))
+}
+
+// admitPlayer reports whether the player of tr may connect to the managed server.
+// If the server is not ready it is started, and the outcome of the start is returned.
+func (g *gcpController) admitPlayer(ctx context.Context, server proxy.RegisteredServer, tr trigger) (allowed bool, outcome startOutcome) {
+	// Check if server is ready, from the background probe unless its result is outdated
+	if g.cachedReady(server) {
+		g.log.V(1).Info("Server is ready, allowing connection",
+			"player", tr.Player,
+			"server", server.ServerInfo().Name())
+		return true, outcome
+	}
+
+	// Server is not ready, attempt to start it
+	g.log.Info("Server is not ready, attempting to start GCP instance",
+		"player", tr.Player,
 		"server", server.ServerInfo().Name())
 
-	if err := g.tryStartServer(e.Player().Context()); err != nil {
+	outcome, err := g.tryStartServer(ctx, tr)
+	if err != nil {
 		g.log.Error(err, "Failed to start GCP instance")
 	}
 
-	// Deny connection and kick player with message
-	e.Deny()
-	e.Player().Disconnect(&c.Text{
-		Content: g.config.StartingMessage,
-	})
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if outcome != startFailed {
+		// Told about the recovery if the boot hangs
+		g.waitingPlayers[tr.PlayerID] = tr.Player
+	}
+	if outcome == startInProgress && g.watchdogAttempts > 0 && g.isStarting {
+		outcome = startRecovering
+	}
+	return false, outcome
 }
 
 // onServerPostConnect handles player successfully connecting to a server
@@ -211,15 +1098,28 @@ func (g *gcpController) onServerPostConnect(e *proxy.ServerPostConnectEvent) {
 
 	g.playerCount++
 	g.lastActivity = time.Now()
+	g.lastJoin = g.lastActivity
+	if g.sessionStartedAt.IsZero() {
+		g.sessionStartedAt = g.lastJoin
+	}
+	g.shareActivity()
+	g.notifyActivity()
 
 	// Mark that a player has joined since startup (for safety timer)
 	if !g.hasPlayerJoinedSinceStart {
 		g.hasPlayerJoinedSinceStart = true
+		g.speculativeStart = false
+		g.audit(auditFirstJoin, trigger{
+			Player:   e.Player().Username(),
+			PlayerID: e.Player().ID().String(),
+			Reason:   "player_join",
+		}, auditRecord{})
 
 		// Cancel the no-join safety timer since a player has now joined
 		if g.noJoinSafetyTimer != nil {
 			g.noJoinSafetyTimer.Stop()
 			g.noJoinSafetyTimer = nil
+			g.safetyShutdownAt = time.Time{}
 			g.log.Info("Cancelled no-join safety timer - player successfully joined",
 				"player", e.Player().Username())
 		}
@@ -229,9 +1129,15 @@ func (g *gcpController) onServerPostConnect(e *proxy.ServerPostConnectEvent) {
 	if g.shutdownTimer != nil {
 		g.shutdownTimer.Stop()
 		g.shutdownTimer = nil
+		g.shutdownAt = time.Time{}
 		g.log.Info("Cancelled scheduled server shutdown due to player join",
 			"player", e.Player().Username(),
 			"playerCount", g.playerCount)
+		g.audit(auditShutdownCancelled, trigger{
+			Player:   e.Player().Username(),
+			PlayerID: e.Player().ID().String(),
+			Reason:   "player_join",
+		}, auditRecord{})
 	}
 
 	g.log.V(1).Info("Player connected to managed server",
@@ -256,19 +1162,39 @@ func (g *gcpController) onDisconnect(e *proxy.DisconnectEvent) {
 	}
 
 	g.lastActivity = time.Now()
+	g.shareActivity()
+	g.notifyActivity()
 
 	g.log.V(1).Info("Player disconnected from managed server",
 		"player", player.Username(),
 		"playerCount", g.playerCount)
 
+	if g.flaggedSessions[player.ID().String()] {
+		delete(g.flaggedSessions, player.ID().String())
+		if len(g.flaggedSessions) == 0 {
+			g.flaggedSessionEnded = true
+			g.log.Info("Last flagged session ended", "player", player.Username())
+		}
+	}
+
 	// If no players left, start shutdown timer
 	if g.playerCount == 0 {
-		g.scheduleShutdown()
+		g.scheduleShutdown(trigger{
+			Player:   player.Username(),
+			PlayerID: player.ID().String(),
+			Reason:   "last_player_left",
+		})
 	}
 }
 
 // isServerReachable checks if the server is currently reachable
 func (g *gcpController) isServerReachable(server proxy.RegisteredServer) bool {
+	// A simulated instance is only reachable while it is running, even though
+	// the local server behind it is always up
+	if sim, ok := g.provider.(*simulatedProvider); ok && !sim.isRunning(g.config.instances()) {
+		return false
+	}
+
 	// Try to connect to the server to check if it's reachable
 	// We create a connection request and check if we can establish a connection
 	addr := server.ServerInfo().Addr()
@@ -287,11 +1213,21 @@ func (g *gcpController) isServerReachable(server proxy.RegisteredServer) bool {
 	return true
 }
 
-// tryStartServer attempts to start the GCP instance
-func (g *gcpController) tryStartServer(ctx context.Context) error {
+// tryStartServer attempts to start the GCP instance and reports what it did
+func (g *gcpController) tryStartServer(ctx context.Context, tr trigger) (startOutcome, error) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	// A start operation that didn't complete in time is still being awaited
+	if g.pendingStart {
+		g.log.Info("Start operation is still pending, skipping start request")
+		return startInProgress, nil
+	}
+	if g.transitioning {
+		g.log.Info("Another start or stop is in progress, skipping start request")
+		return startInProgress, nil
+	}
+
 	// Check startup threshold
 	if !g.lastStartTime.IsZero() {
 		threshold := time.Duration(g.config.StartupThresholdMinutes) * time.Minute
@@ -299,72 +1235,204 @@ func (g *gcpController) tryStartServer(ctx context.Context) error {
 			g.log.Info("Within startup threshold, skipping start request",
 				"lastStart", g.lastStartTime,
 				"threshold", threshold)
-			return nil
+			return startCooldown, nil
 		}
 	}
 
-	// Check current instance state
-	instance, err := g.client.Get(ctx, &computepb.GetInstanceRequest{
-		Project:  g.config.ProjectID,
-		Zone:     g.config.Zone,
-		Instance: g.config.InstanceName,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to get instance state: %w", err)
-	}
-
-	status := instance.GetStatus()
-	g.log.Info("Current instance status", "status", status)
+	// Check current state of all instances, only one of them may run at a time
+	instances := g.config.instances()
+	statuses := make([]string, len(instances))
+	for i, inst := range instances {
+		info, err := g.provider.Get(ctx, inst)
+		if err != nil {
+			return startFailed, fmt.Errorf("failed to get instance state of %s: %w", inst.name(), err)
+		}
+		status := info.Status
+		statuses[i] = status
+		g.lastStatus = status
 
-	// Only start if instance is stopped
-	if status != "TERMINATED" && status != "STOPPED" {
-		g.log.Info("Instance is not stopped, skipping start",
+		g.log.Info("Current instance status",
+			"instance", inst.name(),
+			"zone", inst.Zone,
 			"status", status)
-		return nil
+
+		// Only start if all instances are stopped
+		if status != statusTerminated && status != statusStopped {
+			g.log.Info("Instance is not stopped, skipping start",
+				"instance", inst.name(),
+				"status", status)
+			g.activeInstance = i
+			if status != statusRunning {
+				return startInProgress, nil
+			}
+			// Keep the server entry pointed at the running instance, e.g. after a proxy restart
+			return startInProgress, g.routeToInstance(i, info)
+		}
+	}
+
+	// Only one proxy replica may start or stop the instances at a time
+	if g.coordinator != nil {
+		acquired, err := g.coordinator.acquireLease(ctx, g.config.ServerAddress)
+		if err != nil {
+			return startFailed, fmt.Errorf("failed to acquire start lease: %w", err)
+		}
+		if !acquired {
+			g.log.Info("Another proxy replica holds the lease, skipping start")
+			return startInProgress, nil
+		}
+		defer g.releaseLease()
 	}
 
-	// Start the instance
-	g.log.Info("Starting GCP instance",
-		"project", g.config.ProjectID,
-		"zone", g.config.Zone,
-		"instance", g.config.InstanceName)
+	profile, err := g.startProfile(tr.Profile)
+	if err != nil {
+		return startFailed, err
+	}
+	if profile != nil {
+		tr.Profile = profile.Name
+	}
 
-	op, err := g.client.Start(ctx, &computepb.StartInstanceRequest{
-		Project:  g.config.ProjectID,
-		Zone:     g.config.Zone,
-		Instance: g.config.InstanceName,
+	// Local hooks may veto the start, e.g. while a modpack is being synced. They may take
+	// a while, and g.transitioning keeps other starts and stops out meanwhile.
+	g.withoutLock(func() {
+		err = g.runHooks(ctx, hookBeforeStart, hookEvent{
+			instance: instances[0],
+			trigger:  tr,
+			status:   statuses[0],
+		})
 	})
 	if err != nil {
-		return fmt.Errorf("failed to start instance: %w", err)
+		g.audit(auditStartFailed, tr, auditRecord{
+			Instance:     instances[0].name(),
+			Zone:         instances[0].Zone,
+			StatusBefore: statuses[0],
+			Error:        err.Error(),
+		})
+		return startFailed, err
 	}
 
-	// Wait for operation to complete (with timeout)
-	waitCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
-	defer cancel()
+	requestedAt := time.Now()
+	g.audit(auditStartRequested, tr, auditRecord{
+		Instance:     instances[0].name(),
+		Zone:         instances[0].Zone,
+		StatusBefore: statuses[0],
+	})
+	return g.startFrom(ctx, 0, statuses, profile, tr, requestedAt)
+}
+
+// startFrom starts the instances in order beginning at index until one comes up, falling back to
+// the next one when a zone has no capacity left. statuses are the statuses of the instances
+// before the start. Must be called with g.mu held; it is released while the API is called.
+func (g *gcpController) startFrom(ctx context.Context, index int, statuses []string, profile *StartProfileConfig,
+	tr trigger, requestedAt time.Time) (startOutcome, error) {
+	instances := g.config.instances()
+	for i := index; i < len(instances); i++ {
+		inst := instances[i]
+		opStart := time.Now()
+		var operation string
+		var err error
+		g.withoutLock(func() {
+			err = g.resetReadinessSignal(ctx, inst)
+			if err == nil {
+				err = g.applyStartProfile(ctx, inst, profile)
+			}
+			if err == nil {
+				operation, err = g.provider.Start(ctx, inst)
+			}
+		})
+		if err == nil {
+			g.startedProfile = tr.Profile
+			var handedOver bool
+			handedOver, err = g.awaitOperation(ctx, pendingOperation{
+				Name:          operation,
+				Kind:          operationStart,
+				Server:        g.config.ServerAddress,
+				Instance:      inst,
+				InstanceIndex: i,
+				RequestedAt:   requestedAt,
+				StatusBefore:  statuses[i],
+				Trigger:       tr,
+			})
+			if handedOver {
+				// The state is updated once the operation completed
+				return startRequested, nil
+			}
+		}
+
+		rec := auditRecord{
+			Instance:        inst.name(),
+			Zone:            inst.Zone,
+			StatusBefore:    statuses[i],
+			StatusAfter:     g.currentStatus(ctx, inst),
+			DurationSeconds: time.Since(opStart).Seconds(),
+		}
+		g.lastStatus = rec.StatusAfter
+		if err == nil {
+			g.audit(auditStartSucceeded, tr, rec)
+			g.startCompleted(ctx, i, requestedAt, tr)
+			return startRequested, nil
+		}
+		rec.Error = err.Error()
+		g.audit(auditStartFailed, tr, rec)
+
+		if !isCapacityError(err) || i == len(instances)-1 {
+			return startFailed, err
+		}
+
+		g.log.Info("Zone has no capacity to start instance, trying next fallback instance",
+			"instance", inst.name(),
+			"zone", inst.Zone,
+			"next", instances[i+1].name(),
+			"error", err.Error())
+	}
 
-	if err := op.Wait(waitCtx); err != nil {
-		return fmt.Errorf("failed to wait for start operation: %w", err)
+	return startFailed, nil
+}
+
+// startCompleted updates the state after the start of the instance with the given index
+// requested at requestedAt has completed. Must be called with g.mu held.
+func (g *gcpController) startCompleted(ctx context.Context, index int, requestedAt time.Time, tr trigger) {
+	inst := g.config.instances()[index]
+
+	g.activeInstance = index
+	g.routePending = false
+	if err := g.routeToStartedInstance(ctx, index); err != nil {
+		// Retried while waiting for the boot
+		g.routePending = true
+		g.log.Info("Could not point server entry at started instance yet",
+			"instance", inst.name(),
+			"error", err.Error())
 	}
 
 	g.lastStartTime = time.Now()
 	g.isStarting = true
+	g.bootStartedAt = requestedAt
 	g.hasPlayerJoinedSinceStart = false
+	g.speculativeStart = tr.Reason == reasonPredictedJoin
+	g.watchdogAttempts = 0
+	g.watchdogGaveUp = false
+	g.resetSession()
+	g.notifyActivity()
+	g.invalidateReadiness()
+	g.publishDNS(inst)
+
+	g.log.Info("Successfully started GCP instance",
+		"instance", inst.name(),
+		"zone", inst.Zone)
 
-	g.log.Info("Successfully started GCP instance")
+	// Measure how long the server takes to become reachable
+	go g.watchBoot(requestedAt)
 
 	// Schedule safety timer to shutdown if no one joins
 	g.scheduleNoJoinSafetyShutdown()
-
-	return nil
 }
 
 // scheduleShutdown schedules the server to shutdown after the idle timeout
-func (g *gcpController) scheduleShutdown() {
+func (g *gcpController) scheduleShutdown(tr trigger) {
 	if g.shutdownTimer != nil {
 		g.shutdownTimer.Stop()
 	}
 
-	timeout := time.Duration(g.config.IdleTimeoutMinutes) * time.Minute
+	timeout := g.idleTimeout()
 	g.shutdownTimer = time.AfterFunc(timeout, func() {
 		g.mu.Lock()
 		defer g.mu.Unlock()
@@ -372,23 +1440,47 @@ func (g *gcpController) scheduleShutdown() {
 		// Double-check no players have joined
 		if g.playerCount > 0 {
 			g.log.Info("Players online, cancelling shutdown")
+			g.audit(auditShutdownCancelled, trigger{Reason: "players_online"}, auditRecord{})
 			return
 		}
 
-		g.log.Info("Idle timeout reached, shutting down GCP instance",
-			"timeout", timeout)
-
 		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 		defer cancel()
 
-		if err := g.stopServer(ctx); err != nil {
+		// Players may still be online on another proxy replica. Check again later, in
+		// case that replica goes away without scheduling a shutdown itself.
+		if g.coordinator != nil {
+			remote, err := g.coordinator.remoteActivity(ctx, g.config.ServerAddress)
+			if err != nil {
+				g.log.Error(err, "Failed to check other proxy replicas, postponing shutdown")
+				g.scheduleShutdown(trigger{Reason: "replica_state_unavailable"})
+				return
+			}
+			if remote.Players > 0 {
+				g.log.Info("Players online on other proxy replicas, postponing shutdown",
+					"players", remote.Players)
+				g.scheduleShutdown(trigger{Reason: "remote_players"})
+				return
+			}
+		}
+
+		g.log.Info("Idle timeout reached, shutting down GCP instance",
+			"timeout", timeout)
+
+		if err := g.stopServer(ctx, auditStop, "idle_timeout"); err != nil {
 			g.log.Error(err, "Failed to shutdown GCP instance")
 		}
 	})
 
+	g.shutdownAt = time.Now().Add(timeout)
+	g.notifyActivity()
+
 	g.log.Info("Scheduled server shutdown",
 		"timeout", timeout,
-		"shutdownAt", time.Now().Add(timeout))
+		"shutdownAt", g.shutdownAt)
+	g.audit(auditShutdownScheduled, tr, auditRecord{
+		DurationSeconds: timeout.Seconds(),
+	})
 }
 
 // scheduleNoJoinSafetyShutdown schedules a safety shutdown if no player joins after server startup
@@ -401,6 +1493,10 @@ func (g *gcpController) scheduleNoJoinSafetyShutdown() {
 	}
 
 	timeout := time.Duration(g.config.NoJoinTimeoutMinutes) * time.Minute
+	if g.speculativeStart {
+		// Nobody asked for this start, so a wrong prediction may only cost this much
+		timeout = time.Duration(g.config.Prediction.MaxSpeculativeMinutes) * time.Minute
+	}
 	g.noJoinSafetyTimer = time.AfterFunc(timeout, func() {
 		g.mu.Lock()
 		defer g.mu.Unlock()
@@ -412,6 +1508,23 @@ func (g *gcpController) scheduleNoJoinSafetyShutdown() {
 			return
 		}
 
+		// Players may have joined through another proxy replica
+		if g.coordinator != nil {
+			checkCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			remote, err := g.coordinator.remoteActivity(checkCtx, g.config.ServerAddress)
+			cancel()
+			if err != nil {
+				g.log.Error(err, "Failed to check other proxy replicas, skipping safety shutdown")
+				g.noJoinSafetyTimer = nil
+				return
+			}
+			if remote.Players > 0 || remote.LastJoin.After(g.lastStartTime) {
+				g.log.Info("Player has joined through another proxy replica, cancelling safety shutdown")
+				g.noJoinSafetyTimer = nil
+				return
+			}
+		}
+
 		// No player joined, shutdown the server to save costs
 		g.log.Info("No player joined after server startup, shutting down GCP instance to prevent unnecessary costs",
 			"timeout", timeout,
@@ -420,7 +1533,7 @@ func (g *gcpController) scheduleNoJoinSafetyShutdown() {
 		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 		defer cancel()
 
-		if err := g.stopServer(ctx); err != nil {
+		if err := g.stopServer(ctx, auditSafetyShutdown, "no_join_timeout"); err != nil {
 			g.log.Error(err, "Failed to execute safety shutdown")
 		} else {
 			g.log.Info("Safety shutdown completed successfully")
@@ -429,54 +1542,162 @@ func (g *gcpController) scheduleNoJoinSafetyShutdown() {
 		g.noJoinSafetyTimer = nil
 	})
 
+	g.safetyShutdownAt = time.Now().Add(timeout)
+	g.notifyActivity()
+
 	g.log.Info("Scheduled no-join safety shutdown",
 		"timeout", timeout,
-		"shutdownAt", time.Now().Add(timeout))
+		"shutdownAt", g.safetyShutdownAt)
 }
 
-// stopServer stops the GCP instance
-func (g *gcpController) stopServer(ctx context.Context) error {
-	// Check current instance state
-	instance, err := g.client.Get(ctx, &computepb.GetInstanceRequest{
-		Project:  g.config.ProjectID,
-		Zone:     g.config.Zone,
-		Instance: g.config.InstanceName,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to get instance state: %w", err)
+// stopServer stops the GCP instance, including any running fallback instance.
+// event and reason describe the stop in the audit log.
+func (g *gcpController) stopServer(ctx context.Context, event, reason string) error {
+	if g.transitioning {
+		return errTransitionInProgress
+	}
+
+	// Only one proxy replica may start or stop the instances at a time
+	if g.coordinator != nil {
+		acquired, err := g.coordinator.acquireLease(ctx, g.config.ServerAddress)
+		if err != nil {
+			return fmt.Errorf("failed to acquire stop lease: %w", err)
+		}
+		if !acquired {
+			g.log.Info("Another proxy replica holds the lease, skipping stop")
+			return nil
+		}
+		defer g.releaseLease()
 	}
 
-	status := instance.GetStatus()
-	g.log.Info("Current instance status before stop", "status", status)
+	var stopped bool
+	for _, inst := range g.config.instances() {
+		// Check current instance state
+		info, err := g.provider.Get(ctx, inst)
+		if err != nil {
+			return fmt.Errorf("failed to get instance state of %s: %w", inst.name(), err)
+		}
+		status := info.Status
 
-	// Only stop if instance is running
-	if status != "RUNNING" {
-		g.log.Info("Instance is not running, skipping stop",
+		g.log.Info("Current instance status before stop",
+			"instance", inst.name(),
+			"zone", inst.Zone,
 			"status", status)
-		return nil
-	}
 
-	// Stop the instance
-	g.log.Info("Stopping GCP instance",
-		"project", g.config.ProjectID,
-		"zone", g.config.Zone,
-		"instance", g.config.InstanceName)
+		// Only stop if instance is running
+		if status != statusRunning {
+			continue
+		}
 
-	op, err := g.client.Stop(ctx, &computepb.StopInstanceRequest{
-		Project:  g.config.ProjectID,
-		Zone:     g.config.Zone,
-		Instance: g.config.InstanceName,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to stop instance: %w", err)
-	}
+		tr := trigger{Reason: reason}
+		g.withoutLock(func() {
+			err = g.runHooks(ctx, hookBeforeStop, hookEvent{
+				instance: inst,
+				trigger:  tr,
+				status:   status,
+			})
+		})
+		if err != nil {
+			g.audit(auditStopFailed, tr, auditRecord{
+				Instance:     inst.name(),
+				Zone:         inst.Zone,
+				StatusBefore: status,
+				Error:        err.Error(),
+			})
+			return err
+		}
+		// A player may have joined while the hooks ran
+		if g.playerCount > 0 {
+			g.log.Info("Players joined while the stop hooks ran, cancelling stop",
+				"playerCount", g.playerCount)
+			return nil
+		}
 
-	// Wait for operation to complete
-	if err := op.Wait(ctx); err != nil {
-		return fmt.Errorf("failed to wait for stop operation: %w", err)
+		opStart := time.Now()
+		var operation string
+		g.withoutLock(func() {
+			operation, err = g.provider.Stop(ctx, inst)
+		})
+		if err == nil {
+			var handedOver bool
+			handedOver, err = g.awaitOperation(ctx, pendingOperation{
+				Name:         operation,
+				Kind:         operationStop,
+				Server:       g.config.ServerAddress,
+				Instance:     inst,
+				RequestedAt:  opStart,
+				StatusBefore: status,
+				AuditEvent:   event,
+				Trigger:      tr,
+			})
+			if handedOver {
+				// Audited once the operation completed
+				stopped = true
+				continue
+			}
+		}
+
+		rec := auditRecord{
+			Instance:        inst.name(),
+			Zone:            inst.Zone,
+			StatusBefore:    status,
+			StatusAfter:     g.currentStatus(ctx, inst),
+			DurationSeconds: time.Since(opStart).Seconds(),
+		}
+		if !g.lastStartTime.IsZero() {
+			rec.UptimeSeconds = time.Since(g.lastStartTime).Seconds()
+		}
+		g.lastStatus = rec.StatusAfter
+		if err != nil {
+			rec.Error = err.Error()
+			g.audit(auditStopFailed, tr, rec)
+			return err
+		}
+		g.audit(event, tr, rec)
+		stopped = true
+		go g.runHooks(context.Background(), hookAfterStop, hookEvent{
+			instance: inst,
+			trigger:  tr,
+			status:   status,
+			duration: time.Duration(rec.UptimeSeconds * float64(time.Second)),
+		})
+
+		g.log.Info("Successfully stopped GCP instance",
+			"instance", inst.name())
 	}
 
-	g.log.Info("Successfully stopped GCP instance")
+	if stopped {
+		g.invalidateReadiness()
+		g.unpublishDNS()
+	} else {
+		g.log.Info("No instance is running, skipping stop")
+	}
+	g.isStarting = false
+	clear(g.waitingPlayers)
+	g.resetSession()
+	g.notifyActivity()
 
 	return nil
 }
+
+// withoutLock runs fn with g.mu released, e.g. while waiting for an operation or a hook, so event
+// handlers and heartbeats aren't blocked meanwhile. g.transitioning keeps other starts, stops and
+// recoveries out until fn returned. Must be called with g.mu held.
+func (g *gcpController) withoutLock(fn func()) {
+	g.transitioning = true
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		g.transitioning = false
+	}()
+	fn()
+}
+
+// currentStatus returns the status of an instance for logging, or statusUnknown if it can't be read
+func (g *gcpController) currentStatus(ctx context.Context, inst InstanceConfig) string {
+	info, err := g.provider.Get(ctx, inst)
+	if err != nil {
+		return statusUnknown
+	}
+	return info.Status
+}
@@ -0,0 +1,322 @@
+package gcpcontroller
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	jconfig "go.minekube.com/gate/pkg/edition/java/config"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+
+	"github.com/minekube/gate-plugin-template/plugins/gcpcontroller/internal/fakecompute"
+)
+
+const (
+	testProject  = "test-project"
+	testZone     = "europe-west1-b"
+	testInstance = "minecraft"
+	testServer   = "server1"
+)
+
+// newTestController creates a controller managing a fake instance with the given status.
+// configure may adjust the config before the controller is created.
+func newTestController(t *testing.T, status string, configure func(*Config)) (*gcpController, *fakecompute.Server) {
+	t.Helper()
+
+	fake := fakecompute.New(t)
+	fake.AddInstance(testProject, testZone, testInstance, status, "10.0.0.2")
+
+	cfg := jconfig.DefaultConfig
+	cfg.Servers = nil
+	cfg.Try = nil
+	p, err := proxy.New(proxy.Options{Config: &cfg})
+	if err != nil {
+		t.Fatalf("failed to create proxy: %v", err)
+	}
+	if _, err := p.Register(proxy.NewServerInfo(testServer, serverAddr("127.0.0.1:25566"))); err != nil {
+		t.Fatalf("failed to register server: %v", err)
+	}
+
+	dir := t.TempDir()
+	config := &Config{
+		ProjectID:               testProject,
+		Zone:                    testZone,
+		InstanceName:            testInstance,
+		ServerAddress:           testServer,
+		IdleTimeoutMinutes:      30,
+		StartupThresholdMinutes: 5,
+		NoJoinTimeoutMinutes:    60,
+		AddressSource:           addressSourceInternal,
+		DataDir:                 dir,
+		BootHistorySize:         10,
+		DefaultBootSeconds:      60,
+		AuditLogPath:            filepath.Join(dir, "audit.jsonl"),
+		Readiness:               ReadinessConfig{Source: readinessNetwork},
+	}
+	if configure != nil {
+		configure(config)
+	}
+
+	provider, err := newGCPProvider(context.Background(), logr.Discard(), fake.ClientOptions()...)
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	g := &gcpController{
+		proxy:           p,
+		config:          config,
+		provider:        provider,
+		bootHistory:     newBootHistory(filepath.Join(dir, "boot-history.json"), 10, time.Minute),
+		auditLog:        &auditLog{path: config.AuditLogPath},
+		operations:      &operationStore{path: filepath.Join(dir, "operations.json")},
+		knownIPs:        make(map[string]knownIP),
+		flaggedSessions: make(map[string]bool),
+		waitingPlayers:  make(map[string]string),
+		log:             logr.Discard(),
+		lastActivity:    time.Now(),
+	}
+	t.Cleanup(func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		for _, timer := range []*time.Timer{g.shutdownTimer, g.noJoinSafetyTimer} {
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+	})
+	return g, fake
+}
+
+// waitFor fails the test if cond doesn't become true within a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// auditEvents returns the events recorded in the audit log in order
+func auditEvents(t *testing.T, g *gcpController) []string {
+	t.Helper()
+
+	records, err := g.auditLog.all()
+	if err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+	events := make([]string, len(records))
+	for i, rec := range records {
+		events[i] = rec.Event
+	}
+	return events
+}
+
+func TestStartOnConnect(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, nil)
+
+	allowed, outcome := g.admitPlayer(context.Background(), g.proxy.Server(testServer), trigger{
+		Player:   "Steve",
+		PlayerID: "steve-id",
+		Reason:   "player_connect",
+	})
+	if allowed || outcome != startRequested {
+		t.Errorf("admitPlayer = %v, %v, want false, %v", allowed, outcome, startRequested)
+	}
+
+	if n := fake.Requests(fakecompute.ActionStart); n != 1 {
+		t.Errorf("start requests = %d, want 1", n)
+	}
+	if status := fake.Status(testProject, testZone, testInstance); status != statusRunning {
+		t.Errorf("instance status = %s, want %s", status, statusRunning)
+	}
+
+	server := g.proxy.Server(testServer)
+	if server == nil {
+		t.Fatal("server entry is not registered anymore")
+	}
+	if addr := server.ServerInfo().Addr().String(); addr != "10.0.0.2:25566" {
+		t.Errorf("server entry address = %s, want 10.0.0.2:25566", addr)
+	}
+
+	g.mu.RLock()
+	isStarting, pendingStart := g.isStarting, g.pendingStart
+	waiting := g.waitingPlayers["steve-id"]
+	g.mu.RUnlock()
+	if !isStarting || pendingStart {
+		t.Errorf("isStarting = %v, pendingStart = %v, want true, false", isStarting, pendingStart)
+	}
+	if waiting != "Steve" {
+		t.Errorf("waiting player = %q, want Steve", waiting)
+	}
+
+	events := auditEvents(t, g)
+	want := []string{auditStartRequested, auditStartSucceeded}
+	if len(events) != len(want) || events[0] != want[0] || events[1] != want[1] {
+		t.Errorf("audit events = %v, want %v", events, want)
+	}
+}
+
+func TestConnectWhenReady(t *testing.T) {
+	g, fake := newTestController(t, statusRunning, nil)
+	server := listenServer(t, g)
+
+	if allowed, _ := g.admitPlayer(context.Background(), server, trigger{Player: "Steve", Reason: "player_connect"}); !allowed {
+		t.Error("admitPlayer = false, want true for a ready server")
+	}
+	if n := fake.Requests(fakecompute.ActionStart); n != 0 {
+		t.Errorf("start requests = %d, want 0", n)
+	}
+}
+
+func TestStartFailure(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, nil)
+	fake.FailOperations(fakecompute.ActionStart, "ZONE_RESOURCE_POOL_EXHAUSTED")
+
+	outcome, err := g.tryStartServer(context.Background(), trigger{Reason: "player_connect"})
+	if err == nil || !isCapacityError(err) {
+		t.Fatalf("tryStartServer error = %v, want capacity error", err)
+	}
+	if outcome != startFailed {
+		t.Errorf("outcome = %v, want %v", outcome, startFailed)
+	}
+	if status := fake.Status(testProject, testZone, testInstance); status != statusTerminated {
+		t.Errorf("instance status = %s, want %s", status, statusTerminated)
+	}
+
+	events := auditEvents(t, g)
+	if len(events) != 2 || events[1] != auditStartFailed {
+		t.Errorf("audit events = %v, want start_requested, start_failed", events)
+	}
+}
+
+func TestStartupThreshold(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, nil)
+	ctx := context.Background()
+
+	if _, err := g.tryStartServer(ctx, trigger{Reason: "player_connect"}); err != nil {
+		t.Fatalf("tryStartServer: %v", err)
+	}
+
+	// Stopped outside of the controller, a start within the threshold is skipped anyway
+	fake.SetStatus(testProject, testZone, testInstance, statusTerminated)
+	outcome, err := g.tryStartServer(ctx, trigger{Reason: "player_connect"})
+	if err != nil {
+		t.Fatalf("tryStartServer: %v", err)
+	}
+	if outcome != startCooldown {
+		t.Errorf("outcome within threshold = %v, want %v", outcome, startCooldown)
+	}
+	if n := fake.Requests(fakecompute.ActionStart); n != 1 {
+		t.Errorf("start requests within threshold = %d, want 1", n)
+	}
+
+	g.mu.Lock()
+	g.lastStartTime = time.Now().Add(-6 * time.Minute)
+	g.mu.Unlock()
+
+	if _, err := g.tryStartServer(ctx, trigger{Reason: "player_connect"}); err != nil {
+		t.Fatalf("tryStartServer: %v", err)
+	}
+	if n := fake.Requests(fakecompute.ActionStart); n != 2 {
+		t.Errorf("start requests after threshold = %d, want 2", n)
+	}
+	if status := fake.Status(testProject, testZone, testInstance); status != statusRunning {
+		t.Errorf("instance status = %s, want %s", status, statusRunning)
+	}
+}
+
+func TestIdleShutdown(t *testing.T) {
+	g, fake := newTestController(t, statusRunning, func(c *Config) {
+		c.IdleTimeoutMinutes = 0
+	})
+
+	g.mu.Lock()
+	g.scheduleShutdown(trigger{Reason: "last_player_left"})
+	g.mu.Unlock()
+
+	waitFor(t, "idle shutdown", func() bool {
+		return fake.Status(testProject, testZone, testInstance) == statusTerminated
+	})
+	if n := fake.Requests(fakecompute.ActionStop); n != 1 {
+		t.Errorf("stop requests = %d, want 1", n)
+	}
+	waitFor(t, "stop audit record", func() bool {
+		events := auditEvents(t, g)
+		return len(events) > 0 && events[len(events)-1] == auditStop
+	})
+}
+
+func TestIdleShutdownWithPlayers(t *testing.T) {
+	g, fake := newTestController(t, statusRunning, func(c *Config) {
+		c.IdleTimeoutMinutes = 0
+	})
+
+	g.mu.Lock()
+	g.playerCount = 1
+	g.scheduleShutdown(trigger{Reason: "last_player_left"})
+	g.mu.Unlock()
+
+	// The timer fires right away and cancels the shutdown after checking the player count
+	waitFor(t, "shutdown cancellation", func() bool {
+		events := auditEvents(t, g)
+		return len(events) > 0 && events[len(events)-1] == auditShutdownCancelled
+	})
+
+	if n := fake.Requests(fakecompute.ActionStop); n != 0 {
+		t.Errorf("stop requests = %d, want 0", n)
+	}
+	if status := fake.Status(testProject, testZone, testInstance); status != statusRunning {
+		t.Errorf("instance status = %s, want %s", status, statusRunning)
+	}
+}
+
+func TestNoJoinSafetyShutdown(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, func(c *Config) {
+		c.NoJoinTimeoutMinutes = 0
+	})
+
+	if _, err := g.tryStartServer(context.Background(), trigger{Reason: "player_connect"}); err != nil {
+		t.Fatalf("tryStartServer: %v", err)
+	}
+
+	waitFor(t, "safety shutdown", func() bool {
+		return fake.Status(testProject, testZone, testInstance) == statusTerminated
+	})
+	waitFor(t, "safety shutdown audit record", func() bool {
+		events := auditEvents(t, g)
+		return len(events) > 0 && events[len(events)-1] == auditSafetyShutdown
+	})
+}
+
+func TestNoJoinSafetyShutdownAfterJoin(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, nil)
+
+	if _, err := g.tryStartServer(context.Background(), trigger{Reason: "player_connect"}); err != nil {
+		t.Fatalf("tryStartServer: %v", err)
+	}
+
+	// A player joined, then the safety timer fires
+	g.mu.Lock()
+	g.hasPlayerJoinedSinceStart = true
+	g.config.NoJoinTimeoutMinutes = 0
+	g.scheduleNoJoinSafetyShutdown()
+	g.mu.Unlock()
+
+	waitFor(t, "safety timer", func() bool {
+		g.mu.RLock()
+		defer g.mu.RUnlock()
+		return g.noJoinSafetyTimer == nil
+	})
+	if n := fake.Requests(fakecompute.ActionStop); n != 0 {
+		t.Errorf("stop requests = %d, want 0", n)
+	}
+	if status := fake.Status(testProject, testZone, testInstance); status != statusRunning {
+		t.Errorf("instance status = %s, want %s", status, statusRunning)
+	}
+}
@@ -0,0 +1,187 @@
+package gcpcontroller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lifecycle transitions hooks can run on
+const (
+	hookBeforeStart = "beforeStart"
+	hookAfterReady  = "afterReady"
+	hookBeforeStop  = "beforeStop"
+	hookAfterStop   = "afterStop"
+)
+
+// maxHookOutput is how much output of a hook is kept for the log
+const maxHookOutput = 16 << 10
+
+// HookConfig configures a local command run on a lifecycle transition. Either Shell or Exec must be set.
+type HookConfig struct {
+	// Shell is a command line run with sh -c
+	Shell string `mapstructure:"shell"`
+	// Exec is a program and its arguments run without a shell
+	Exec []string `mapstructure:"exec"`
+	// TimeoutSeconds is how long the command may run before it is killed (default: 30)
+	TimeoutSeconds int `mapstructure:"timeoutSeconds"`
+	// AbortOnFailure cancels the start or stop if the command fails. Only for before hooks.
+	AbortOnFailure bool `mapstructure:"abortOnFailure"`
+}
+
+// HooksConfig configures the hooks of every lifecycle transition, run in order
+type HooksConfig struct {
+	BeforeStart []HookConfig `mapstructure:"beforeStart"`
+	AfterReady  []HookConfig `mapstructure:"afterReady"`
+	BeforeStop  []HookConfig `mapstructure:"beforeStop"`
+	AfterStop   []HookConfig `mapstructure:"afterStop"`
+}
+
+// forHook returns the hooks of a lifecycle transition
+func (h HooksConfig) forHook(hook string) []HookConfig {
+	switch hook {
+	case hookBeforeStart:
+		return h.BeforeStart
+	case hookAfterReady:
+		return h.AfterReady
+	case hookBeforeStop:
+		return h.BeforeStop
+	case hookAfterStop:
+		return h.AfterStop
+	default:
+		return nil
+	}
+}
+
+// validate checks the hooks and defaults their timeouts
+func (h HooksConfig) validate() error {
+	for _, hook := range []string{hookBeforeStart, hookAfterReady, hookBeforeStop, hookAfterStop} {
+		for i := range h.forHook(hook) {
+			config := &h.forHook(hook)[i]
+			key := fmt.Sprintf("gcpController.hooks.%s[%d]", hook, i)
+
+			if (config.Shell == "") == (len(config.Exec) == 0) {
+				return fmt.Errorf("%s requires either shell or exec", key)
+			}
+			if config.TimeoutSeconds == 0 {
+				config.TimeoutSeconds = 30
+			}
+			if config.TimeoutSeconds < 0 {
+				return fmt.Errorf("%s.timeoutSeconds must not be negative", key)
+			}
+			if config.AbortOnFailure && hook != hookBeforeStart && hook != hookBeforeStop {
+				return fmt.Errorf("%s.abortOnFailure is only supported by beforeStart and beforeStop hooks", key)
+			}
+		}
+	}
+	return nil
+}
+
+// hookEvent describes a lifecycle transition to the hooks run on it
+type hookEvent struct {
+	instance InstanceConfig
+	trigger  trigger
+	// status is the status of the instance before the transition
+	status string
+	// duration is the boot time for afterReady, and the uptime for afterStop
+	duration time.Duration
+}
+
+// errHookAborted is returned if a failing hook aborted a transition
+var errHookAborted = errors.New("aborted by hook")
+
+// runHooks runs the hooks of a lifecycle transition in order. It returns an error wrapping
+// errHookAborted if a hook with abortOnFailure failed; other failures are only logged.
+func (g *gcpController) runHooks(ctx context.Context, hook string, ev hookEvent) error {
+	hooks := g.config.Hooks.forHook(hook)
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	env := append(os.Environ(),
+		"GCP_HOOK="+hook,
+		"GCP_SERVER="+g.config.ServerAddress,
+		"GCP_PROJECT="+ev.instance.ProjectID,
+		"GCP_ZONE="+ev.instance.Zone,
+		"GCP_INSTANCE="+ev.instance.name(),
+		"GCP_STATUS="+ev.status,
+		"GCP_REASON="+ev.trigger.Reason,
+		"GCP_PLAYER="+ev.trigger.Player,
+		"GCP_PLAYER_ID="+ev.trigger.PlayerID,
+		"GCP_PROFILE="+ev.trigger.Profile,
+	)
+	if server := g.proxy.Server(g.config.ServerAddress); server != nil {
+		env = append(env, "GCP_ADDRESS="+server.ServerInfo().Addr().String())
+	}
+	switch hook {
+	case hookAfterReady:
+		env = append(env, "GCP_BOOT_SECONDS="+strconv.Itoa(int(ev.duration.Seconds())))
+	case hookAfterStop:
+		env = append(env, "GCP_UPTIME_SECONDS="+strconv.Itoa(int(ev.duration.Seconds())))
+	}
+
+	for i, config := range hooks {
+		log := g.log.WithValues("hook", hook, "index", i)
+
+		started := time.Now()
+		output, err := runHookCommand(ctx, config, env)
+		if len(output) > 0 {
+			log.Info("Hook output", "output", strings.TrimSpace(output))
+		}
+		if err == nil {
+			log.V(1).Info("Hook completed", "duration", time.Since(started).Round(time.Millisecond))
+			continue
+		}
+
+		log.Error(err, "Hook failed", "abortOnFailure", config.AbortOnFailure)
+		if config.AbortOnFailure {
+			return fmt.Errorf("%w %s[%d]: %w", errHookAborted, hook, i, err)
+		}
+	}
+	return nil
+}
+
+// runHookCommand runs the command of a hook and returns its combined output
+func runHookCommand(ctx context.Context, config HookConfig, env []string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if config.Shell != "" {
+		cmd = exec.CommandContext(ctx, "sh", "-c", config.Shell)
+	} else {
+		cmd = exec.CommandContext(ctx, config.Exec[0], config.Exec[1:]...)
+	}
+	cmd.Env = env
+	// Don't wait for background processes of the hook that keep its output open
+	cmd.WaitDelay = time.Second
+
+	output := &limitedBuffer{limit: maxHookOutput}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %ds", config.TimeoutSeconds)
+	}
+	return output.String(), err
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the rest
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
@@ -0,0 +1,142 @@
+package gcpcontroller
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minekube/gate-plugin-template/plugins/gcpcontroller/internal/fakecompute"
+)
+
+func TestBeforeStartHook(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), "env")
+	g, fake := newTestController(t, statusTerminated, func(c *Config) {
+		c.Hooks.BeforeStart = []HookConfig{{
+			Shell:          `echo "$GCP_HOOK $GCP_INSTANCE $GCP_REASON $GCP_PLAYER" > ` + envFile,
+			TimeoutSeconds: 5,
+		}}
+	})
+
+	tr := trigger{Player: "alice", PlayerID: "a", Reason: "player_connect"}
+	if _, err := g.tryStartServer(context.Background(), tr); err != nil {
+		t.Fatalf("tryStartServer: %v", err)
+	}
+
+	data, err := os.ReadFile(envFile)
+	if err != nil {
+		t.Fatalf("hook did not run: %v", err)
+	}
+	if got, want := strings.TrimSpace(string(data)), "beforeStart minecraft player_connect alice"; got != want {
+		t.Errorf("hook environment = %q, want %q", got, want)
+	}
+	if n := fake.Requests(fakecompute.ActionStart); n != 1 {
+		t.Errorf("start requests = %d, want 1", n)
+	}
+}
+
+func TestBeforeStartHookAbort(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, func(c *Config) {
+		c.Hooks.BeforeStart = []HookConfig{
+			// Failures of other hooks are only logged
+			{Exec: []string{"false"}, TimeoutSeconds: 5},
+			{Shell: "sleep 10", TimeoutSeconds: 1, AbortOnFailure: true},
+		}
+	})
+
+	outcome, err := g.tryStartServer(context.Background(), trigger{Reason: "player_connect"})
+	if !errors.Is(err, errHookAborted) {
+		t.Fatalf("tryStartServer: err = %v, want %v", err, errHookAborted)
+	}
+	if outcome != startFailed {
+		t.Errorf("outcome = %v, want %v", outcome, startFailed)
+	}
+	if n := fake.Requests(fakecompute.ActionStart); n != 0 {
+		t.Errorf("start requests = %d, want 0", n)
+	}
+}
+
+func TestBeforeStartHookTimeoutWhileConnecting(t *testing.T) {
+	started := filepath.Join(t.TempDir(), "started")
+	g, fake := newTestController(t, statusTerminated, func(c *Config) {
+		c.Hooks.BeforeStart = []HookConfig{{Shell: "touch " + started + " && sleep 10", TimeoutSeconds: 1}}
+	})
+
+	done := make(chan startOutcome)
+	go func() {
+		outcome, err := g.tryStartServer(context.Background(), trigger{Player: "alice", PlayerID: "a", Reason: "player_connect"})
+		if err != nil {
+			t.Errorf("tryStartServer: %v", err)
+		}
+		done <- outcome
+	}()
+	waitFor(t, "hook to run", func() bool {
+		_, err := os.Stat(started)
+		return err == nil
+	})
+
+	// Another player connecting meanwhile is told that the server is starting, without waiting for the hook
+	connected := time.Now()
+	allowed, outcome := g.admitPlayer(context.Background(), g.proxy.Server(testServer),
+		trigger{Player: "bob", PlayerID: "b", Reason: "player_connect"})
+	if allowed || outcome != startInProgress {
+		t.Errorf("admitPlayer during the hook = %v, %v, want false, %v", allowed, outcome, startInProgress)
+	}
+	if elapsed := time.Since(connected); elapsed > time.Second {
+		t.Errorf("admitPlayer took %v while the hook ran", elapsed)
+	}
+
+	// The timed out hook doesn't abort the start
+	if outcome := <-done; outcome != startRequested {
+		t.Errorf("outcome = %v, want %v", outcome, startRequested)
+	}
+	if n := fake.Requests(fakecompute.ActionStart); n != 1 {
+		t.Errorf("start requests = %d, want 1", n)
+	}
+}
+
+func TestBeforeStopHookPlayerJoins(t *testing.T) {
+	started := filepath.Join(t.TempDir(), "started")
+	g, fake := newTestController(t, statusRunning, func(c *Config) {
+		c.Hooks.BeforeStop = []HookConfig{{Shell: "touch " + started + " && sleep 10", TimeoutSeconds: 1}}
+	})
+
+	done := make(chan error)
+	go func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		done <- g.stopServer(context.Background(), auditStop, "idle_timeout")
+	}()
+	waitFor(t, "hook to run", func() bool {
+		_, err := os.Stat(started)
+		return err == nil
+	})
+
+	g.mu.Lock()
+	g.playerCount = 1
+	g.mu.Unlock()
+
+	if err := <-done; err != nil {
+		t.Fatalf("stopServer: %v", err)
+	}
+	if n := fake.Requests(fakecompute.ActionStop); n != 0 {
+		t.Errorf("stop requests = %d, want 0", n)
+	}
+}
+
+func TestHooksValidation(t *testing.T) {
+	invalid := []HooksConfig{
+		{BeforeStart: []HookConfig{{}}},
+		{BeforeStop: []HookConfig{{Shell: "true", Exec: []string{"true"}}}},
+		{AfterStop: []HookConfig{{Shell: "true", AbortOnFailure: true}}},
+		{AfterReady: []HookConfig{{Shell: "true", TimeoutSeconds: -1}}},
+	}
+	for _, hooks := range invalid {
+		if err := hooks.validate(); err == nil {
+			t.Errorf("validate(%+v) succeeded, want error", hooks)
+		}
+	}
+}
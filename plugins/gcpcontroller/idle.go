@@ -0,0 +1,231 @@
+package gcpcontroller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Supported values for idlePolicies[].type
+const (
+	idlePolicyMinimumUptime   = "minimumUptime"
+	idlePolicySessionScaled   = "sessionScaled"
+	idlePolicyNight           = "night"
+	idlePolicyOperatorSession = "operatorSession"
+)
+
+// IdlePolicyConfig configures an idle policy. Only the fields of its type are used.
+type IdlePolicyConfig struct {
+	Type string `mapstructure:"type"`
+	// Minutes is the minimum uptime for minimumUptime, and the timeout at night for night
+	Minutes int `mapstructure:"minutes"`
+	// Factor scales the session length into the timeout for sessionScaled
+	Factor float64 `mapstructure:"factor"`
+	// MinMinutes and MaxMinutes bound the scaled timeout for sessionScaled
+	MinMinutes int `mapstructure:"minMinutes"`
+	MaxMinutes int `mapstructure:"maxMinutes"`
+	// From and To are the start and end of the night as HH:MM for night
+	From string `mapstructure:"from"`
+	To   string `mapstructure:"to"`
+	// Timezone is the IANA time zone From and To are in for night (default: local time)
+	Timezone string `mapstructure:"timezone"`
+}
+
+// idleState is what idle policies base the timeout on, taken when the last player left
+type idleState struct {
+	now time.Time
+	// startedAt is when the instance was last started by this proxy, zero if unknown
+	startedAt time.Time
+	// session is how long players have been on the server since the first join after the start
+	session time.Duration
+	// flaggedSessionEnded is true if the last session flagged by an operator has ended
+	flaggedSessionEnded bool
+}
+
+// idlePolicy adjusts the idle timeout after the last player left the managed server.
+// Policies are applied in configuration order, each one receiving the timeout of the previous one.
+type idlePolicy interface {
+	timeout(state idleState, current time.Duration) time.Duration
+}
+
+// newIdlePolicies creates the idle policies of the configuration
+func newIdlePolicies(configs []IdlePolicyConfig) ([]idlePolicy, error) {
+	policies := make([]idlePolicy, 0, len(configs))
+	for i, config := range configs {
+		policy, err := newIdlePolicy(config)
+		if err != nil {
+			return nil, fmt.Errorf("gcpController.idlePolicies[%d]: %w", i, err)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// newIdlePolicy creates a single idle policy
+func newIdlePolicy(config IdlePolicyConfig) (idlePolicy, error) {
+	switch config.Type {
+	case idlePolicyMinimumUptime:
+		if config.Minutes < 1 {
+			return nil, fmt.Errorf("minutes must be at least 1")
+		}
+		return minimumUptimePolicy{minimum: time.Duration(config.Minutes) * time.Minute}, nil
+
+	case idlePolicySessionScaled:
+		if config.Factor <= 0 {
+			return nil, fmt.Errorf("factor must be greater than 0")
+		}
+		if config.MinMinutes < 0 || config.MaxMinutes < config.MinMinutes {
+			return nil, fmt.Errorf("minMinutes must not be negative and maxMinutes must be at least minMinutes")
+		}
+		return sessionScaledPolicy{
+			factor: config.Factor,
+			min:    time.Duration(config.MinMinutes) * time.Minute,
+			max:    time.Duration(config.MaxMinutes) * time.Minute,
+		}, nil
+
+	case idlePolicyNight:
+		from, err := parseTimeOfDay(config.From)
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+		to, err := parseTimeOfDay(config.To)
+		if err != nil {
+			return nil, fmt.Errorf("to: %w", err)
+		}
+		if config.Minutes < 0 {
+			return nil, fmt.Errorf("minutes must not be negative")
+		}
+		loc := time.Local
+		if config.Timezone != "" {
+			loc, err = time.LoadLocation(config.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timezone %q: %w", config.Timezone, err)
+			}
+		}
+		return nightPolicy{
+			from:         from,
+			to:           to,
+			location:     loc,
+			nightTimeout: time.Duration(config.Minutes) * time.Minute,
+		}, nil
+
+	case idlePolicyOperatorSession:
+		return operatorSessionPolicy{}, nil
+
+	default:
+		return nil, fmt.Errorf("type must be %q, %q, %q or %q, got %q",
+			idlePolicyMinimumUptime, idlePolicySessionScaled, idlePolicyNight, idlePolicyOperatorSession, config.Type)
+	}
+}
+
+// minimumUptimePolicy keeps the instance running for a minimum time after it started,
+// so a short test session doesn't start and stop it again right away
+type minimumUptimePolicy struct {
+	minimum time.Duration
+}
+
+func (p minimumUptimePolicy) timeout(state idleState, current time.Duration) time.Duration {
+	if state.startedAt.IsZero() {
+		return current
+	}
+	return max(current, state.startedAt.Add(p.minimum).Sub(state.now))
+}
+
+// sessionScaledPolicy waits longer after long sessions, where players are likely to relog,
+// and shorter after short ones
+type sessionScaledPolicy struct {
+	factor   float64
+	min, max time.Duration
+}
+
+func (p sessionScaledPolicy) timeout(state idleState, _ time.Duration) time.Duration {
+	scaled := time.Duration(float64(state.session) * p.factor)
+	return min(max(scaled, p.min), p.max)
+}
+
+// nightPolicy shortens the timeout during the night, when players are unlikely to come back
+type nightPolicy struct {
+	from, to     time.Duration // time of day
+	location     *time.Location
+	nightTimeout time.Duration
+}
+
+func (p nightPolicy) timeout(state idleState, current time.Duration) time.Duration {
+	now := state.now.In(p.location)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, p.location)
+	sinceMidnight := now.Sub(midnight)
+
+	var night bool
+	if p.from <= p.to {
+		night = sinceMidnight >= p.from && sinceMidnight < p.to
+	} else {
+		// The night spans midnight, e.g. 23:00 to 07:00
+		night = sinceMidnight >= p.from || sinceMidnight < p.to
+	}
+	if !night {
+		return current
+	}
+	return min(current, p.nightTimeout)
+}
+
+// operatorSessionPolicy stops the instance right away once the last session an operator
+// flagged with /gcp flag has ended and nobody else is online
+type operatorSessionPolicy struct{}
+
+func (operatorSessionPolicy) timeout(state idleState, current time.Duration) time.Duration {
+	if state.flaggedSessionEnded {
+		return 0
+	}
+	return current
+}
+
+// parseTimeOfDay parses a time of day like 23:30 into the duration since midnight
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// idleTimeout returns the idle timeout after the last player left, starting from
+// idleTimeoutMinutes and adjusted by the configured idle policies. Must be called with g.mu held.
+func (g *gcpController) idleTimeout() time.Duration {
+	state := idleState{
+		now:                 time.Now(),
+		startedAt:           g.lastStartTime,
+		flaggedSessionEnded: g.flaggedSessionEnded,
+	}
+	if !g.sessionStartedAt.IsZero() {
+		state.session = state.now.Sub(g.sessionStartedAt)
+	}
+
+	timeout := time.Duration(g.config.IdleTimeoutMinutes) * time.Minute
+	for _, policy := range g.config.idlePolicies {
+		timeout = policy.timeout(state, timeout)
+	}
+	return max(timeout, 0)
+}
+
+// resetSession forgets the current session and its flags, e.g. when the instance started or
+// stopped. Must be called with g.mu held.
+func (g *gcpController) resetSession() {
+	g.sessionStartedAt = time.Time{}
+	clear(g.flaggedSessions)
+	g.flaggedSessionEnded = false
+}
+
+// toggleSessionFlag flags or unflags the session of a player on the managed server and
+// reports whether it is flagged now
+func (g *gcpController) toggleSessionFlag(playerID string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.flaggedSessions[playerID] {
+		delete(g.flaggedSessions, playerID)
+		return false
+	}
+	g.flaggedSessions[playerID] = true
+	g.flaggedSessionEnded = false
+	return true
+}
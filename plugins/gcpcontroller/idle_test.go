@@ -0,0 +1,99 @@
+package gcpcontroller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdlePolicies(t *testing.T) {
+	// 23:30 UTC
+	now := time.Date(2024, 5, 1, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		policies []IdlePolicyConfig
+		state    idleState
+		expected time.Duration
+	}{
+		{
+			name:     "no policies",
+			state:    idleState{now: now},
+			expected: 30 * time.Minute,
+		},
+		{
+			name:     "minimum uptime extends the timeout",
+			policies: []IdlePolicyConfig{{Type: idlePolicyMinimumUptime, Minutes: 60}},
+			state:    idleState{now: now, startedAt: now.Add(-10 * time.Minute)},
+			expected: 50 * time.Minute,
+		},
+		{
+			name:     "minimum uptime already reached",
+			policies: []IdlePolicyConfig{{Type: idlePolicyMinimumUptime, Minutes: 60}},
+			state:    idleState{now: now, startedAt: now.Add(-2 * time.Hour)},
+			expected: 30 * time.Minute,
+		},
+		{
+			name:     "short session",
+			policies: []IdlePolicyConfig{{Type: idlePolicySessionScaled, Factor: 0.25, MinMinutes: 5, MaxMinutes: 45}},
+			state:    idleState{now: now, session: 5 * time.Minute},
+			expected: 5 * time.Minute,
+		},
+		{
+			name:     "long session",
+			policies: []IdlePolicyConfig{{Type: idlePolicySessionScaled, Factor: 0.25, MinMinutes: 5, MaxMinutes: 45}},
+			state:    idleState{now: now, session: 4 * time.Hour},
+			expected: 45 * time.Minute,
+		},
+		{
+			name:     "night spanning midnight",
+			policies: []IdlePolicyConfig{{Type: idlePolicyNight, From: "23:00", To: "07:00", Minutes: 5, Timezone: "UTC"}},
+			state:    idleState{now: now},
+			expected: 5 * time.Minute,
+		},
+		{
+			name:     "day",
+			policies: []IdlePolicyConfig{{Type: idlePolicyNight, From: "01:00", To: "07:00", Minutes: 5, Timezone: "UTC"}},
+			state:    idleState{now: now},
+			expected: 30 * time.Minute,
+		},
+		{
+			name: "flagged session ended before minimum uptime",
+			policies: []IdlePolicyConfig{
+				{Type: idlePolicyMinimumUptime, Minutes: 60},
+				{Type: idlePolicyOperatorSession},
+			},
+			state:    idleState{now: now, startedAt: now.Add(-10 * time.Minute), flaggedSessionEnded: true},
+			expected: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policies, err := newIdlePolicies(tt.policies)
+			if err != nil {
+				t.Fatalf("newIdlePolicies: %v", err)
+			}
+			timeout := 30 * time.Minute
+			for _, policy := range policies {
+				timeout = policy.timeout(tt.state, timeout)
+			}
+			if timeout != tt.expected {
+				t.Errorf("timeout = %v, want %v", timeout, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIdlePolicyValidation(t *testing.T) {
+	invalid := []IdlePolicyConfig{
+		{Type: "weekend"},
+		{Type: idlePolicyMinimumUptime},
+		{Type: idlePolicySessionScaled, Factor: 1, MinMinutes: 10, MaxMinutes: 5},
+		{Type: idlePolicyNight, From: "25:00", To: "07:00"},
+		{Type: idlePolicyNight, From: "23:00", To: "07:00", Timezone: "Mars/Olympus"},
+	}
+	for _, config := range invalid {
+		if _, err := newIdlePolicy(config); err == nil {
+			t.Errorf("newIdlePolicy(%+v) succeeded, want error", config)
+		}
+	}
+}
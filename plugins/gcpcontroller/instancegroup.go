@@ -0,0 +1,209 @@
+package gcpcontroller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	compute "cloud.google.com/go/compute/apiv1"
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"google.golang.org/api/iterator"
+)
+
+// errNoGroupMember is returned for an instance group that has been resized to 0
+var errNoGroupMember = errors.New("instance group has no instance")
+
+// Actions of a managed instance while the MIG creates or deletes it
+var (
+	groupCreatingActions = []string{"CREATING", "CREATING_WITHOUT_RETRIES", "RECREATING"}
+	groupDeletingActions = []string{"DELETING", "ABANDONING"}
+)
+
+// groupInstance returns the instance of a managed instance group, or nil if the group has been
+// resized to 0. The group is expected to hold at most one instance.
+func (p *gcpProvider) groupInstance(ctx context.Context, inst InstanceConfig) (*computepb.ManagedInstance, error) {
+	it := p.groups.ListManagedInstances(ctx, &computepb.ListManagedInstancesInstanceGroupManagersRequest{
+		Project:              inst.ProjectID,
+		Zone:                 inst.Zone,
+		InstanceGroupManager: inst.InstanceGroup,
+	})
+
+	var first *computepb.ManagedInstance
+	for {
+		managed, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list instances of group %s: %w", inst.InstanceGroup, err)
+		}
+		if first == nil {
+			first = managed
+			continue
+		}
+		p.log.Info("Instance group has more than one instance, only managing the first",
+			"group", inst.InstanceGroup,
+			"instance", first.GetName(),
+			"ignored", managed.GetName())
+	}
+	return first, nil
+}
+
+// groupMember returns the config of the instance a managed instance group currently holds
+func groupMember(inst InstanceConfig, managed *computepb.ManagedInstance) InstanceConfig {
+	member := inst
+	member.InstanceGroup = ""
+	member.InstanceName = managed.GetName()
+	return member
+}
+
+// resolveGroupMember returns inst itself, or the instance its group currently holds
+func (p *gcpProvider) resolveGroupMember(ctx context.Context, inst InstanceConfig) (InstanceConfig, error) {
+	if inst.InstanceGroup == "" {
+		return inst, nil
+	}
+	managed, err := p.groupInstance(ctx, inst)
+	if err != nil {
+		return inst, err
+	}
+	if managed == nil {
+		return inst, fmt.Errorf("%w: %s", errNoGroupMember, inst.InstanceGroup)
+	}
+	return groupMember(inst, managed), nil
+}
+
+// getGroup returns the state of the instance a managed instance group holds. A group
+// that has been resized to 0 is reported as TERMINATED.
+func (p *gcpProvider) getGroup(ctx context.Context, inst InstanceConfig) (*instanceInfo, error) {
+	managed, err := p.groupInstance(ctx, inst)
+	if err != nil {
+		return nil, err
+	}
+	if managed == nil {
+		return &instanceInfo{Status: statusTerminated}, nil
+	}
+
+	action := managed.GetCurrentAction()
+	switch {
+	case slices.Contains(groupCreatingActions, action):
+		return &instanceInfo{Status: statusStaging}, nil
+	case slices.Contains(groupDeletingActions, action):
+		return &instanceInfo{Status: statusStopping}, nil
+	}
+
+	return p.Get(ctx, groupMember(inst, managed))
+}
+
+// startGroup brings up the instance of a managed instance group. A stopped or suspended
+// instance, as left behind by stopGroup for stateful groups, is started again. Otherwise the
+// group is resized to 1 and creates a new instance from its template.
+func (p *gcpProvider) startGroup(ctx context.Context, inst InstanceConfig) (string, error) {
+	p.log.Info("Starting GCP instance group",
+		"project", inst.ProjectID,
+		"zone", inst.Zone,
+		"group", inst.InstanceGroup)
+
+	managed, err := p.groupInstance(ctx, inst)
+	if err != nil {
+		return "", err
+	}
+
+	var op *compute.Operation
+	switch {
+	case managed == nil:
+		op, err = p.groups.Resize(ctx, &computepb.ResizeInstanceGroupManagerRequest{
+			Project:              inst.ProjectID,
+			Zone:                 inst.Zone,
+			InstanceGroupManager: inst.InstanceGroup,
+			Size:                 1,
+		})
+	case managed.GetInstanceStatus() == statusTerminated || managed.GetInstanceStatus() == statusStopped:
+		op, err = p.groups.StartInstances(ctx, &computepb.StartInstancesInstanceGroupManagerRequest{
+			Project:              inst.ProjectID,
+			Zone:                 inst.Zone,
+			InstanceGroupManager: inst.InstanceGroup,
+			InstanceGroupManagersStartInstancesRequestResource: &computepb.InstanceGroupManagersStartInstancesRequest{
+				Instances: []string{managed.GetInstance()},
+			},
+		})
+	case managed.GetInstanceStatus() == statusSuspended:
+		op, err = p.groups.ResumeInstances(ctx, &computepb.ResumeInstancesInstanceGroupManagerRequest{
+			Project:              inst.ProjectID,
+			Zone:                 inst.Zone,
+			InstanceGroupManager: inst.InstanceGroup,
+			InstanceGroupManagersResumeInstancesRequestResource: &computepb.InstanceGroupManagersResumeInstancesRequest{
+				Instances: []string{managed.GetInstance()},
+			},
+		})
+	default:
+		p.log.Info("Instance group already has an active instance",
+			"group", inst.InstanceGroup,
+			"instance", managed.GetName(),
+			"status", managed.GetInstanceStatus())
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to start instance group: %w", err)
+	}
+
+	return op.Name(), nil
+}
+
+// stopGroup takes down the instance of a managed instance group. If the group preserves any
+// disk as stateful, the instance is stopped so it keeps its disks. Otherwise the group is
+// resized to 0, which deletes the instance.
+func (p *gcpProvider) stopGroup(ctx context.Context, inst InstanceConfig) (string, error) {
+	p.log.Info("Stopping GCP instance group",
+		"project", inst.ProjectID,
+		"zone", inst.Zone,
+		"group", inst.InstanceGroup)
+
+	group, err := p.groups.Get(ctx, &computepb.GetInstanceGroupManagerRequest{
+		Project:              inst.ProjectID,
+		Zone:                 inst.Zone,
+		InstanceGroupManager: inst.InstanceGroup,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get instance group: %w", err)
+	}
+
+	managed, err := p.groupInstance(ctx, inst)
+	if err != nil {
+		return "", err
+	}
+	if managed == nil {
+		return "", nil
+	}
+
+	var op *compute.Operation
+	if hasStatefulDisks(group, managed) {
+		op, err = p.groups.StopInstances(ctx, &computepb.StopInstancesInstanceGroupManagerRequest{
+			Project:              inst.ProjectID,
+			Zone:                 inst.Zone,
+			InstanceGroupManager: inst.InstanceGroup,
+			InstanceGroupManagersStopInstancesRequestResource: &computepb.InstanceGroupManagersStopInstancesRequest{
+				Instances: []string{managed.GetInstance()},
+			},
+		})
+	} else {
+		op, err = p.groups.Resize(ctx, &computepb.ResizeInstanceGroupManagerRequest{
+			Project:              inst.ProjectID,
+			Zone:                 inst.Zone,
+			InstanceGroupManager: inst.InstanceGroup,
+			Size:                 0,
+		})
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to stop instance group: %w", err)
+	}
+
+	return op.Name(), nil
+}
+
+// hasStatefulDisks reports whether the group's stateful policy or the instance's
+// per-instance config preserves any disk, which would be lost by deleting the instance
+func hasStatefulDisks(group *computepb.InstanceGroupManager, managed *computepb.ManagedInstance) bool {
+	return len(group.GetStatefulPolicy().GetPreservedState().GetDisks()) > 0 ||
+		len(managed.GetPreservedStateFromConfig().GetDisks()) > 0
+}
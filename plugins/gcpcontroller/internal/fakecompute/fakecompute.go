@@ -0,0 +1,585 @@
+// Package fakecompute provides an in-memory fake of the Compute Engine instances and zone
+// operations REST API for tests. Point a compute REST client at it with ClientOptions.
+//
+// Start, stop, suspend, resume and reset return a RUNNING operation that is DONE once its delay has
+// passed. The instance moves through the same statuses as on GCE meanwhile. setMetadata
+// completes right away and checks the fingerprint like GCE. serialPort returns the output set
+// with SetSerialOutput, and testIamPermissions grants all permissions not denied with
+// DenyPermissions. Requests and operations can be
+// made to fail for testing error handling.
+package fakecompute
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Actions that can be delayed, failed and counted
+const (
+	ActionGet       = "get"
+	ActionStart     = "start"
+	ActionStop      = "stop"
+	ActionSuspend   = "suspend"
+	ActionResume    = "resume"
+	ActionReset     = "reset"
+	ActionMetadata  = "setMetadata"
+	ActionLabels    = "setLabels"
+	ActionSerial    = "serialPort"
+	ActionTestIAM   = "testIamPermissions"
+	ActionOperation = "operation"
+)
+
+// transitions describes how an action moves an instance: from the statuses it is accepted in,
+// through an intermediate status into the final status
+var transitions = map[string]struct {
+	from         []string
+	intermediate string
+	final        string
+}{
+	ActionStart:   {from: []string{"TERMINATED", "STOPPED"}, intermediate: "STAGING", final: "RUNNING"},
+	ActionStop:    {from: []string{"RUNNING", "SUSPENDED"}, intermediate: "STOPPING", final: "TERMINATED"},
+	ActionSuspend: {from: []string{"RUNNING"}, intermediate: "SUSPENDING", final: "SUSPENDED"},
+	ActionResume:  {from: []string{"SUSPENDED"}, intermediate: "STAGING", final: "RUNNING"},
+	// A reset keeps the instance RUNNING while the guest reboots
+	ActionReset: {from: []string{"RUNNING"}, intermediate: "RUNNING", final: "RUNNING"},
+}
+
+// instance is the state of a fake instance
+type instance struct {
+	name       string
+	status     string
+	internalIP string
+	externalIP string
+	metadata   map[string]string
+	labels     map[string]string
+	// fingerprint changes with every metadata update, labelFingerprint with every labels update
+	fingerprint      int
+	labelFingerprint int
+	// serialOutput is the content of serial port 1
+	serialOutput string
+}
+
+// operation is a fake zone operation
+type operation struct {
+	name     string
+	action   string
+	instance *instance
+	doneAt   time.Time
+	done     bool
+	// errCode fails the operation with this GCE error code, e.g. ZONE_RESOURCE_POOL_EXHAUSTED
+	errCode    string
+	prevStatus string
+}
+
+// failure makes the next count requests of an action fail with an HTTP error
+type failure struct {
+	code  int
+	count int
+}
+
+// Server is a fake Compute Engine REST API
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	instances   map[string]*instance // project/zone/name -> instance
+	operations  map[string]*operation
+	delays      map[string]time.Duration
+	failures    map[string]*failure
+	opErrors    map[string]string
+	requests    map[string]int
+	denied      []string // permissions testIamPermissions doesn't grant
+	nextOpIndex int
+}
+
+// New starts a fake Compute Engine REST API. It is closed when the test ends.
+func New(t interface{ Cleanup(func()) }) *Server {
+	s := &Server{
+		instances:  make(map[string]*instance),
+		operations: make(map[string]*operation),
+		delays:     make(map[string]time.Duration),
+		failures:   make(map[string]*failure),
+		opErrors:   make(map[string]string),
+		requests:   make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /compute/v1/projects/{project}/zones/{zone}/instances/{instance}", s.handleGet)
+	mux.HandleFunc("GET /compute/v1/projects/{project}/zones/{zone}/instances/{instance}/serialPort", s.handleSerialPort)
+	mux.HandleFunc("POST /compute/v1/projects/{project}/zones/{zone}/instances/{instance}/{action}", s.handleAction)
+	mux.HandleFunc("GET /compute/v1/projects/{project}/zones/{zone}/operations/{operation}", s.handleOperation)
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// ClientOptions returns the options that point a compute REST client at the fake
+func (s *Server) ClientOptions() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(s.URL),
+		option.WithoutAuthentication(),
+		option.WithHTTPClient(s.Client()),
+	}
+}
+
+// AddInstance creates a fake instance with the given status, e.g. TERMINATED or RUNNING
+func (s *Server) AddInstance(project, zone, name, status, internalIP string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.instances[key(project, zone, name)] = &instance{
+		name:       name,
+		status:     status,
+		internalIP: internalIP,
+		metadata:   make(map[string]string),
+		labels:     make(map[string]string),
+	}
+}
+
+// Metadata returns a copy of the metadata items of a fake instance
+func (s *Server) Metadata(project, zone, name string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if inst, ok := s.instances[key(project, zone, name)]; ok {
+		return maps.Clone(inst.metadata)
+	}
+	return nil
+}
+
+// Labels returns a copy of the labels of a fake instance
+func (s *Server) Labels(project, zone, name string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if inst, ok := s.instances[key(project, zone, name)]; ok {
+		return maps.Clone(inst.labels)
+	}
+	return nil
+}
+
+// SetSerialOutput sets the serial port output of a fake instance
+func (s *Server) SetSerialOutput(project, zone, name, output string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if inst, ok := s.instances[key(project, zone, name)]; ok {
+		inst.serialOutput = output
+	}
+}
+
+// DenyPermissions makes testIamPermissions leave out the given permissions
+func (s *Server) DenyPermissions(permissions ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.denied = append(s.denied, permissions...)
+}
+
+// SetStatus changes the status of a fake instance directly, e.g. to simulate a manual stop
+func (s *Server) SetStatus(project, zone, name, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if inst, ok := s.instances[key(project, zone, name)]; ok {
+		inst.status = status
+	}
+}
+
+// Status returns the current status of a fake instance, or an empty string if it doesn't exist
+func (s *Server) Status(project, zone, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.advance()
+	if inst, ok := s.instances[key(project, zone, name)]; ok {
+		return inst.status
+	}
+	return ""
+}
+
+// SetDelay sets how long the operations of an action take
+func (s *Server) SetDelay(action string, delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delays[action] = delay
+}
+
+// FailRequests makes the next count requests of an action fail with the HTTP status code
+func (s *Server) FailRequests(action string, code, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[action] = &failure{code: code, count: count}
+}
+
+// FailOperations makes the operations of an action fail with a GCE error code,
+// e.g. ZONE_RESOURCE_POOL_EXHAUSTED. An empty code lets them succeed again.
+func (s *Server) FailOperations(action, errCode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opErrors[action] = errCode
+}
+
+// Requests returns how many requests of an action have been received
+func (s *Server) Requests(action string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[action]
+}
+
+// handleGet returns a fake instance
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.request(w, ActionGet) {
+		return
+	}
+	s.advance()
+
+	inst, ok := s.instances[key(r.PathValue("project"), r.PathValue("zone"), r.PathValue("instance"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", "instance not found")
+		return
+	}
+
+	resp := &computepb.Instance{
+		Name:   proto.String(inst.name),
+		Status: proto.String(inst.status),
+		Metadata: &computepb.Metadata{
+			Fingerprint: proto.String(strconv.Itoa(inst.fingerprint)),
+		},
+		Labels:           maps.Clone(inst.labels),
+		LabelFingerprint: proto.String(strconv.Itoa(inst.labelFingerprint)),
+	}
+	for _, k := range slices.Sorted(maps.Keys(inst.metadata)) {
+		resp.Metadata.Items = append(resp.Metadata.Items, &computepb.Items{
+			Key:   proto.String(k),
+			Value: proto.String(inst.metadata[k]),
+		})
+	}
+	if inst.status == "RUNNING" {
+		nic := &computepb.NetworkInterface{NetworkIP: proto.String(inst.internalIP)}
+		if inst.externalIP != "" {
+			nic.AccessConfigs = []*computepb.AccessConfig{{NatIP: proto.String(inst.externalIP)}}
+		}
+		resp.NetworkInterfaces = []*computepb.NetworkInterface{nic}
+	}
+	writeProto(w, resp)
+}
+
+// handleSerialPort returns the serial port output of a fake instance
+func (s *Server) handleSerialPort(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.request(w, ActionSerial) {
+		return
+	}
+
+	inst, ok := s.instances[key(r.PathValue("project"), r.PathValue("zone"), r.PathValue("instance"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", "instance not found")
+		return
+	}
+	writeProto(w, &computepb.SerialPortOutput{
+		Contents: proto.String(inst.serialOutput),
+		Next:     proto.Int64(int64(len(inst.serialOutput))),
+	})
+}
+
+// handleAction starts an operation that moves a fake instance into another status
+func (s *Server) handleAction(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	action := r.PathValue("action")
+	switch action {
+	case ActionMetadata:
+		s.handleSetMetadata(w, r)
+		return
+	case ActionLabels:
+		s.handleSetLabels(w, r)
+		return
+	case ActionTestIAM:
+		s.handleTestPermissions(w, r)
+		return
+	}
+	t, ok := transitions[action]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", "unknown action "+action)
+		return
+	}
+	if !s.request(w, action) {
+		return
+	}
+	s.advance()
+
+	inst, ok := s.instances[key(r.PathValue("project"), r.PathValue("zone"), r.PathValue("instance"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", "instance not found")
+		return
+	}
+
+	s.nextOpIndex++
+	op := &operation{
+		name:       fmt.Sprintf("operation-%d-%s", s.nextOpIndex, action),
+		action:     action,
+		instance:   inst,
+		doneAt:     time.Now().Add(s.delays[action]),
+		errCode:    s.opErrors[action],
+		prevStatus: inst.status,
+	}
+	s.operations[op.name] = op
+
+	// Like GCE, requests for an instance that is already in the target status succeed right away
+	switch {
+	case slices.Contains(t.from, inst.status):
+		inst.status = t.intermediate
+	case inst.status == t.final:
+		op.done = true
+	default:
+		op.done = true
+		op.errCode = "RESOURCE_NOT_READY"
+	}
+
+	writeProto(w, op.proto())
+}
+
+// handleSetMetadata replaces the metadata of a fake instance if the fingerprint matches.
+// Must be called with s.mu held.
+func (s *Server) handleSetMetadata(w http.ResponseWriter, r *http.Request) {
+	if !s.request(w, ActionMetadata) {
+		return
+	}
+
+	inst, ok := s.instances[key(r.PathValue("project"), r.PathValue("zone"), r.PathValue("instance"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", "instance not found")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	var metadata computepb.Metadata
+	if err := protojson.Unmarshal(body, &metadata); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	if metadata.GetFingerprint() != strconv.Itoa(inst.fingerprint) {
+		writeError(w, http.StatusPreconditionFailed, "conditionNotMet", "metadata fingerprint does not match")
+		return
+	}
+
+	inst.metadata = make(map[string]string, len(metadata.GetItems()))
+	for _, item := range metadata.GetItems() {
+		inst.metadata[item.GetKey()] = item.GetValue()
+	}
+	inst.fingerprint++
+
+	s.nextOpIndex++
+	op := &operation{
+		name:     fmt.Sprintf("operation-%d-%s", s.nextOpIndex, ActionMetadata),
+		action:   ActionMetadata,
+		instance: inst,
+		done:     true,
+	}
+	s.operations[op.name] = op
+	writeProto(w, op.proto())
+}
+
+// handleSetLabels replaces the labels of a fake instance if the fingerprint matches.
+// Must be called with s.mu held.
+func (s *Server) handleSetLabels(w http.ResponseWriter, r *http.Request) {
+	if !s.request(w, ActionLabels) {
+		return
+	}
+
+	inst, ok := s.instances[key(r.PathValue("project"), r.PathValue("zone"), r.PathValue("instance"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", "instance not found")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	var req computepb.InstancesSetLabelsRequest
+	if err := protojson.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	if req.GetLabelFingerprint() != strconv.Itoa(inst.labelFingerprint) {
+		writeError(w, http.StatusPreconditionFailed, "conditionNotMet", "label fingerprint does not match")
+		return
+	}
+
+	inst.labels = maps.Clone(req.GetLabels())
+	if inst.labels == nil {
+		inst.labels = make(map[string]string)
+	}
+	inst.labelFingerprint++
+
+	s.nextOpIndex++
+	op := &operation{
+		name:     fmt.Sprintf("operation-%d-%s", s.nextOpIndex, ActionLabels),
+		action:   ActionLabels,
+		instance: inst,
+		done:     true,
+	}
+	s.operations[op.name] = op
+	writeProto(w, op.proto())
+}
+
+// handleTestPermissions returns the requested permissions that weren't denied.
+// Must be called with s.mu held.
+func (s *Server) handleTestPermissions(w http.ResponseWriter, r *http.Request) {
+	if !s.request(w, ActionTestIAM) {
+		return
+	}
+	if _, ok := s.instances[key(r.PathValue("project"), r.PathValue("zone"), r.PathValue("instance"))]; !ok {
+		writeError(w, http.StatusNotFound, "notFound", "instance not found")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "badRequest", err.Error())
+		return
+	}
+	var req computepb.TestPermissionsRequest
+	if err := protojson.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "badRequest", err.Error())
+		return
+	}
+
+	resp := &computepb.TestPermissionsResponse{}
+	for _, permission := range req.GetPermissions() {
+		if !slices.Contains(s.denied, permission) {
+			resp.Permissions = append(resp.Permissions, permission)
+		}
+	}
+	writeProto(w, resp)
+}
+
+// handleOperation returns a fake zone operation
+func (s *Server) handleOperation(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.request(w, ActionOperation) {
+		return
+	}
+	s.advance()
+
+	op, ok := s.operations[r.PathValue("operation")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "notFound", "operation not found")
+		return
+	}
+	writeProto(w, op.proto())
+}
+
+// request counts a request and writes an injected failure. It returns false if the request failed.
+// Must be called with s.mu held.
+func (s *Server) request(w http.ResponseWriter, action string) bool {
+	s.requests[action]++
+
+	f, ok := s.failures[action]
+	if !ok || f.count <= 0 {
+		return true
+	}
+	f.count--
+	writeError(w, f.code, "injected", fmt.Sprintf("injected failure of %s", action))
+	return false
+}
+
+// advance completes all operations whose delay has passed. Must be called with s.mu held.
+func (s *Server) advance() {
+	now := time.Now()
+	for _, op := range s.operations {
+		if op.done || now.Before(op.doneAt) {
+			continue
+		}
+		op.done = true
+		if op.errCode != "" {
+			op.instance.status = op.prevStatus
+			continue
+		}
+		op.instance.status = transitions[op.action].final
+	}
+}
+
+// proto returns the API representation of an operation
+func (op *operation) proto() *computepb.Operation {
+	status := computepb.Operation_RUNNING
+	if op.done {
+		status = computepb.Operation_DONE
+	}
+
+	resp := &computepb.Operation{
+		Name:          proto.String(op.name),
+		OperationType: proto.String(op.action),
+		TargetLink:    proto.String(op.instance.name),
+		Status:        &status,
+	}
+	if op.done && op.errCode != "" {
+		resp.Error = &computepb.Error{
+			Errors: []*computepb.Errors{{
+				Code:    proto.String(op.errCode),
+				Message: proto.String(fmt.Sprintf("%s failed (fake)", op.action)),
+			}},
+		}
+	}
+	return resp
+}
+
+// writeProto writes a message as JSON, like the REST API
+func writeProto(w http.ResponseWriter, msg proto.Message) {
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internalError", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// writeError writes an error in the format of Google APIs
+func writeError(w http.ResponseWriter, code int, reason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"code":    code,
+			"message": message,
+			"errors": []map[string]string{{
+				"reason":  reason,
+				"message": message,
+			}},
+		},
+	})
+}
+
+// key returns the map key of an instance
+func key(project, zone, name string) string {
+	return project + "/" + zone + "/" + name
+}
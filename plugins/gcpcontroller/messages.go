@@ -0,0 +1,135 @@
+package gcpcontroller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/minekube/gate-plugin-template/util"
+	"github.com/minekube/gate-plugin-template/util/mini"
+	c "go.minekube.com/common/minecraft/component"
+)
+
+// Supported values for messages.format
+const (
+	messageFormatLegacy = "legacy"
+	messageFormatMini   = "mini"
+)
+
+// startOutcome is what a start request resulted in, deciding which message a player gets
+type startOutcome int
+
+const (
+	// startRequested means the instance is being started
+	startRequested startOutcome = iota
+	// startInProgress means the instance is already booting, or another replica is starting it
+	startInProgress
+	// startCooldown means the instance was started within the startup threshold
+	startCooldown
+	// startFailed means the instance could not be started
+	startFailed
+	// startRecovering means the instance hung during the boot and is being recovered by the watchdog
+	startRecovering
+)
+
+// MessagesConfig configures the messages players get while the managed server is not ready.
+// Messages support the placeholders {player}, {server}, {status}, {eta}, {elapsed} and {uptime}.
+type MessagesConfig struct {
+	// Format is how messages are styled: legacy ('&' color codes) or mini (<color:red> tags)
+	Format string
+	// StartRequested is shown when the connection started the instance
+	StartRequested string `mapstructure:"startRequested"`
+	// AlreadyStarting is shown when the instance is already booting
+	AlreadyStarting string `mapstructure:"alreadyStarting"`
+	// StartFailed is shown when the instance could not be started
+	StartFailed string `mapstructure:"startFailed"`
+	// StartingCooldown is shown when the instance was started within startupThresholdMinutes
+	StartingCooldown string `mapstructure:"startingCooldown"`
+	// Recovering is shown while the watchdog recovers a hung instance, and sent to players who are waiting
+	Recovering string `mapstructure:"recovering"`
+}
+
+// override returns the messages with every message set in other replaced
+func (m MessagesConfig) override(other MessagesConfig) MessagesConfig {
+	if other.Format != "" {
+		m.Format = other.Format
+	}
+	if other.StartRequested != "" {
+		m.StartRequested = other.StartRequested
+	}
+	if other.AlreadyStarting != "" {
+		m.AlreadyStarting = other.AlreadyStarting
+	}
+	if other.StartFailed != "" {
+		m.StartFailed = other.StartFailed
+	}
+	if other.StartingCooldown != "" {
+		m.StartingCooldown = other.StartingCooldown
+	}
+	if other.Recovering != "" {
+		m.Recovering = other.Recovering
+	}
+	return m
+}
+
+// validateMessages parses the player-facing messages of a server in their format, so bad markup
+// fails when the config is loaded instead of when a player is kicked
+func (cfg *Config) validateMessages() error {
+	if cfg.Messages.Format != messageFormatMini {
+		return nil
+	}
+	for _, msg := range []struct{ key, text string }{
+		{"motd", cfg.Motd},
+		{"messages.startRequested", cfg.Messages.StartRequested},
+		{"messages.alreadyStarting", cfg.Messages.AlreadyStarting},
+		{"messages.startFailed", cfg.Messages.StartFailed},
+		{"messages.startingCooldown", cfg.Messages.StartingCooldown},
+		{"messages.recovering", cfg.Messages.Recovering},
+	} {
+		if err := mini.Validate(msg.text); err != nil {
+			return fmt.Errorf("%s of server %s is not valid mini markup: %w", msg.key, cfg.ServerAddress, err)
+		}
+	}
+	return nil
+}
+
+// forOutcome returns the message for the outcome of a start request
+func (m MessagesConfig) forOutcome(outcome startOutcome) string {
+	switch outcome {
+	case startInProgress:
+		return m.AlreadyStarting
+	case startCooldown:
+		return m.StartingCooldown
+	case startFailed:
+		return m.StartFailed
+	case startRecovering:
+		return m.Recovering
+	default:
+		return m.StartRequested
+	}
+}
+
+// formatMessage fills in the placeholders of a player-facing message and styles it in the
+// configured format. playerName may be empty if the message isn't shown to a specific player.
+func (g *gcpController) formatMessage(msg, playerName string) *c.Text {
+	g.mu.RLock()
+	status := g.lastStatus
+	var uptime time.Duration
+	if !g.lastStartTime.IsZero() && status != statusTerminated && status != statusStopped {
+		uptime = time.Since(g.lastStartTime)
+	}
+	g.mu.RUnlock()
+
+	msg = strings.NewReplacer(
+		"{player}", playerName,
+		"{server}", g.config.ServerAddress,
+		"{status}", strings.ToLower(orUnknown(status)),
+		"{uptime}", formatHours(uptime.Seconds()),
+	).Replace(msg)
+	msg = g.applyPlaceholders(msg)
+
+	if g.config.Messages.Format == messageFormatMini {
+		return mini.Parse(msg)
+	}
+	return util.Join(util.Text(msg))
+}
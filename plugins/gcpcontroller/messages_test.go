@@ -0,0 +1,39 @@
+package gcpcontroller
+
+import "testing"
+
+func TestMessagesValidation(t *testing.T) {
+	valid := []string{
+		"<color:gold>{server} is starting, ready in about {eta}",
+		"<gradient:light_purple:gold>Starting</gradient> <bold>now",
+		"<#ff00ff>Please wait <unknown>and retry",
+		"1 < 2",
+	}
+	for _, msg := range valid {
+		cfg := &Config{ServerAddress: testServer, Messages: MessagesConfig{Format: messageFormatMini, StartFailed: msg}}
+		if err := cfg.validateMessages(); err != nil {
+			t.Errorf("validateMessages(%q) = %v, want nil", msg, err)
+		}
+	}
+
+	invalid := []string{
+		"<color>Starting",
+		"<color:>Starting",
+		"<color:not_a_color>Starting",
+		"<gradient>Starting",
+		"<gradient:gold>Starting",
+		"<#zz>Starting",
+	}
+	for _, msg := range invalid {
+		cfg := &Config{ServerAddress: testServer, Motd: msg, Messages: MessagesConfig{Format: messageFormatMini}}
+		if err := cfg.validateMessages(); err == nil {
+			t.Errorf("validateMessages(%q) succeeded, want error", msg)
+		}
+	}
+
+	// Legacy messages have no markup to reject
+	cfg := &Config{ServerAddress: testServer, Messages: MessagesConfig{Format: messageFormatLegacy, StartFailed: "<color>"}}
+	if err := cfg.validateMessages(); err != nil {
+		t.Errorf("validateMessages of a legacy message = %v, want nil", err)
+	}
+}
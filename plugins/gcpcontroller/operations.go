@@ -0,0 +1,298 @@
+package gcpcontroller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Kinds of pending operations
+const (
+	operationStart = "start"
+	operationStop  = "stop"
+)
+
+// operationWaitTimeout is how long a start or stop request waits for its operation before
+// the operation is handed over to a background watcher
+const operationWaitTimeout = 2 * time.Minute
+
+// operationResumeTimeout is how long a background watcher polls an operation before giving up
+const operationResumeTimeout = 30 * time.Minute
+
+// errTransitionInProgress is returned by a stop while another start, stop or recovery waits
+// with g.mu released
+var errTransitionInProgress = errors.New("another start or stop is in progress")
+
+// pendingOperation is a start or stop operation that has been requested but not completed yet
+type pendingOperation struct {
+	Name          string         `json:"name"`
+	Kind          string         `json:"kind"`
+	Server        string         `json:"server"`
+	Instance      InstanceConfig `json:"instance"`
+	InstanceIndex int            `json:"instanceIndex"`
+	RequestedAt   time.Time      `json:"requestedAt"`
+	StatusBefore  string         `json:"statusBefore,omitempty"`
+	// AuditEvent is the event recorded when a stop completes, e.g. stop or safety_shutdown
+	AuditEvent string  `json:"auditEvent,omitempty"`
+	Trigger    trigger `json:"trigger"`
+	// Lease is whether the operation holds the coordination lease until it completed
+	Lease bool `json:"lease,omitempty"`
+}
+
+// operationStore persists pending operations, so they can be awaited again after a restart
+type operationStore struct {
+	path string
+
+	mu         sync.Mutex
+	operations []pendingOperation
+}
+
+// load loads the pending operations from file
+func (s *operationStore) load() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read pending operations file: %w", err)
+	}
+
+	var operations []pendingOperation
+	if err := json.Unmarshal(data, &operations); err != nil {
+		return fmt.Errorf("failed to parse pending operations file: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operations = operations
+
+	return nil
+}
+
+// forServer returns the pending operations of a managed server
+func (s *operationStore) forServer(server string) []pendingOperation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var operations []pendingOperation
+	for _, op := range s.operations {
+		if op.Server == server {
+			operations = append(operations, op)
+		}
+	}
+	return operations
+}
+
+// add records a pending operation and saves the store to file
+func (s *operationStore) add(op pendingOperation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.operations = append(s.operations, op)
+	return s.save()
+}
+
+// remove forgets a completed operation and saves the store to file
+func (s *operationStore) remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.operations = slices.DeleteFunc(s.operations, func(op pendingOperation) bool {
+		return op.Name == name
+	})
+	return s.save()
+}
+
+// save writes the pending operations to file. Must be called with s.mu held.
+func (s *operationStore) save() error {
+	data, err := json.MarshalIndent(s.operations, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal pending operations: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write pending operations file: %w", err)
+	}
+
+	return nil
+}
+
+// awaitOperation records a requested operation and waits for it to complete. If it doesn't
+// complete within operationWaitTimeout, it is handed over to a background watcher and
+// handedOver is true. Must be called with g.mu held; it is released while waiting.
+func (g *gcpController) awaitOperation(ctx context.Context, op pendingOperation) (handedOver bool, err error) {
+	if op.Name == "" {
+		return false, nil
+	}
+
+	op.Lease = g.coordinator != nil
+	if err := g.operations.add(op); err != nil {
+		g.log.Error(err, "Failed to save pending operation", "operation", op.Name)
+	}
+
+	g.withoutLock(func() {
+		waitCtx, cancel := context.WithTimeout(ctx, operationWaitTimeout)
+		defer cancel()
+		err = g.provider.WaitOperation(waitCtx, op.Instance, op.Name)
+	})
+
+	if err != nil && (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)) {
+		g.log.Info("Operation is still running, waiting for it in the background",
+			"operation", op.Name,
+			"kind", op.Kind,
+			"instance", op.Instance.name())
+		if op.Kind == operationStart {
+			g.pendingStart = true
+		}
+		if op.Lease {
+			g.leaseOperations++
+		}
+		go g.resumeOperation(op)
+		return true, nil
+	}
+
+	if removeErr := g.operations.remove(op.Name); removeErr != nil {
+		g.log.Error(removeErr, "Failed to remove completed operation", "operation", op.Name)
+	}
+	return false, err
+}
+
+// resumeOperation waits for an operation that was requested earlier, e.g. before a restart of
+// the proxy, and updates the controller state once it completed
+func (g *gcpController) resumeOperation(op pendingOperation) {
+	ctx, cancel := context.WithTimeout(context.Background(), operationResumeTimeout)
+	defer cancel()
+
+	var err error
+	for {
+		err = g.provider.WaitOperation(ctx, op.Instance, op.Name)
+		if err == nil || ctx.Err() != nil || !isTransientWaitError(err) {
+			break
+		}
+		g.log.V(1).Info("Failed to poll operation, retrying", "operation", op.Name, "error", err.Error())
+		time.Sleep(operationPollInterval)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if removeErr := g.operations.remove(op.Name); removeErr != nil {
+		g.log.Error(removeErr, "Failed to remove completed operation", "operation", op.Name)
+	}
+	// Other replicas were kept out until the operation completed
+	if op.Lease && g.coordinator != nil {
+		g.leaseOperations--
+		defer g.releaseLease()
+	}
+
+	rec := auditRecord{
+		Instance:        op.Instance.name(),
+		Zone:            op.Instance.Zone,
+		StatusBefore:    op.StatusBefore,
+		StatusAfter:     g.currentStatus(context.Background(), op.Instance),
+		DurationSeconds: time.Since(op.RequestedAt).Seconds(),
+	}
+	g.lastStatus = rec.StatusAfter
+
+	switch op.Kind {
+	case operationStart:
+		g.pendingStart = false
+		if err != nil {
+			rec.Error = err.Error()
+			g.audit(auditStartFailed, op.Trigger, rec)
+			if isCapacityError(err) && op.InstanceIndex < len(g.config.instances())-1 {
+				g.continueFallback(ctx, op)
+				return
+			}
+			g.log.Error(err, "Start operation failed, the next connection attempt will retry",
+				"operation", op.Name,
+				"instance", op.Instance.name())
+			return
+		}
+		g.audit(auditStartSucceeded, op.Trigger, rec)
+		g.startCompleted(ctx, op.InstanceIndex, op.RequestedAt, op.Trigger)
+
+	case operationStop:
+		if !g.lastStartTime.IsZero() {
+			rec.UptimeSeconds = time.Since(g.lastStartTime).Seconds()
+		}
+		if err != nil {
+			rec.Error = err.Error()
+			g.audit(auditStopFailed, op.Trigger, rec)
+			g.log.Error(err, "Stop operation failed",
+				"operation", op.Name,
+				"instance", op.Instance.name())
+			return
+		}
+		g.audit(op.AuditEvent, op.Trigger, rec)
+		g.isStarting = false
+		g.notifyActivity()
+		g.invalidateReadiness()
+		g.unpublishDNS()
+		go g.runHooks(context.Background(), hookAfterStop, hookEvent{
+			instance: op.Instance,
+			trigger:  op.Trigger,
+			status:   op.StatusBefore,
+			duration: time.Duration(rec.UptimeSeconds * float64(time.Second)),
+		})
+		g.log.Info("Successfully stopped GCP instance",
+			"instance", op.Instance.name())
+	}
+}
+
+// continueFallback starts the fallback instances after the one of a start operation that was
+// awaited in the background and failed for lack of capacity. Must be called with g.mu held.
+func (g *gcpController) continueFallback(ctx context.Context, op pendingOperation) {
+	instances := g.config.instances()
+	next := op.InstanceIndex + 1
+	g.log.Info("Zone has no capacity to start instance, trying next fallback instance",
+		"instance", op.Instance.name(),
+		"zone", op.Instance.Zone,
+		"next", instances[next].name())
+
+	if g.transitioning {
+		g.log.Info("Another start or stop is in progress, not trying fallback instances")
+		return
+	}
+	if g.coordinator != nil {
+		acquired, err := g.coordinator.acquireLease(ctx, g.config.ServerAddress)
+		if err != nil {
+			g.log.Error(err, "Failed to acquire start lease, not trying fallback instances")
+			return
+		}
+		if !acquired {
+			g.log.Info("Another proxy replica holds the lease, not trying fallback instances")
+			return
+		}
+		defer g.releaseLease()
+	}
+
+	profile, err := g.startProfile(op.Trigger.Profile)
+	if err != nil {
+		g.log.Error(err, "Failed to start fallback instances")
+		return
+	}
+	statuses := make([]string, len(instances))
+	for i, inst := range instances {
+		statuses[i] = g.currentStatus(ctx, inst)
+	}
+	if _, err := g.startFrom(ctx, next, statuses, profile, op.Trigger, op.RequestedAt); err != nil {
+		g.log.Error(err, "Failed to start fallback instances, the next connection attempt will retry")
+	}
+}
+
+// isTransientWaitError reports whether polling an operation failed for a reason other than
+// the operation itself failing or being gone, e.g. a network error, so polling should be retried
+func isTransientWaitError(err error) bool {
+	var opErr *operationFailedError
+	return !errors.As(err, &opErr) && !isNotFound(err)
+}
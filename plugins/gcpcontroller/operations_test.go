@@ -0,0 +1,93 @@
+package gcpcontroller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/minekube/gate-plugin-template/plugins/gcpcontroller/internal/fakecompute"
+)
+
+const (
+	testFallbackZone     = "europe-west4-a"
+	testFallbackInstance = "minecraft-fallback"
+)
+
+func TestResumedStartFallback(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, func(c *Config) {
+		c.FallbackInstances = []InstanceConfig{{ProjectID: testProject, Zone: testFallbackZone, InstanceName: testFallbackInstance}}
+	})
+	fake.AddInstance(testProject, testFallbackZone, testFallbackInstance, statusTerminated, "10.0.0.3")
+	ctx := context.Background()
+
+	// A start that took too long to be awaited by the connection, and then ran out of capacity
+	fake.FailOperations(fakecompute.ActionStart, "ZONE_RESOURCE_POOL_EXHAUSTED")
+	inst := g.config.instances()[0]
+	operation, err := g.provider.Start(ctx, inst)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	fake.FailOperations(fakecompute.ActionStart, "")
+
+	g.mu.Lock()
+	g.pendingStart = true
+	g.mu.Unlock()
+	g.resumeOperation(pendingOperation{
+		Name:          operation,
+		Kind:          operationStart,
+		Server:        testServer,
+		Instance:      inst,
+		InstanceIndex: 0,
+		RequestedAt:   time.Now(),
+		StatusBefore:  statusTerminated,
+		Trigger:       trigger{Reason: "player_connect"},
+	})
+
+	if status := fake.Status(testProject, testFallbackZone, testFallbackInstance); status != statusRunning {
+		t.Errorf("fallback instance status = %s, want %s", status, statusRunning)
+	}
+	g.mu.RLock()
+	active, starting := g.activeInstance, g.isStarting
+	g.mu.RUnlock()
+	if active != 1 || !starting {
+		t.Errorf("activeInstance = %d, isStarting = %v, want 1, true", active, starting)
+	}
+}
+
+func TestAwaitOperationReleasesLock(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, nil)
+	fake.SetDelay(fakecompute.ActionStart, 2*time.Second)
+
+	done := make(chan startOutcome)
+	go func() {
+		outcome, err := g.tryStartServer(context.Background(), trigger{Reason: "player_connect"})
+		if err != nil {
+			t.Errorf("tryStartServer: %v", err)
+		}
+		done <- outcome
+	}()
+	waitFor(t, "start request", func() bool { return fake.Requests(fakecompute.ActionStart) == 1 })
+
+	// Event handlers get the lock while the operation is awaited, and other starts are skipped
+	locked := make(chan struct{})
+	go func() {
+		g.mu.RLock()
+		g.mu.RUnlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("g.mu is held while the start operation is awaited")
+	}
+	if outcome, err := g.tryStartServer(context.Background(), trigger{Reason: "player_connect"}); err != nil || outcome != startInProgress {
+		t.Errorf("concurrent tryStartServer = %v, %v, want %v", outcome, err, startInProgress)
+	}
+
+	if outcome := <-done; outcome != startRequested {
+		t.Errorf("outcome = %v, want %v", outcome, startRequested)
+	}
+	if n := fake.Requests(fakecompute.ActionStart); n != 1 {
+		t.Errorf("start requests = %d, want 1", n)
+	}
+}
@@ -0,0 +1,333 @@
+package gcpcontroller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.minekube.com/brigodier"
+	"go.minekube.com/common/minecraft/color"
+	c "go.minekube.com/common/minecraft/component"
+	"go.minekube.com/gate/pkg/command"
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// PlayerCommandsConfig configures the commands every player can use, e.g. from a lobby server
+type PlayerCommandsConfig struct {
+	// ServerStatus enables /serverstatus
+	ServerStatus bool
+	// Extend enables /extend
+	Extend bool
+	// ExtendMinutes is how long /extend postpones a pending idle shutdown
+	ExtendMinutes int
+	// MaxExtendsPerPlayer is how often a player may use /extend per server and day, 0 for no limit.
+	// Each proxy replica counts the uses through itself.
+	MaxExtendsPerPlayer int
+	// MaxExtendsPerDay is how often all players together may use /extend per server and day, 0 for no limit.
+	// Each proxy replica counts the uses through itself.
+	MaxExtendsPerDay int
+}
+
+var (
+	errNoShutdownPending = errors.New("no idle shutdown is pending")
+	errPlayerExtendLimit = errors.New("player extend limit reached")
+	errServerExtendLimit = errors.New("daily extend limit reached")
+)
+
+// serverStatus is a snapshot of the state of a managed server shown by /serverstatus
+type serverStatus struct {
+	server   string
+	status   string // status of the instance when it was last checked
+	starting bool
+	eta      time.Duration // expected remaining boot time while starting
+	players  int
+	uptime   time.Duration
+	// shutdownAt is when the pending idle shutdown happens, zero if none is pending
+	shutdownAt time.Time
+	// safetyShutdownAt is when the instance is stopped if nobody joins, zero if not scheduled
+	safetyShutdownAt time.Time
+}
+
+// status returns the current state of the managed server. The instance is only queried
+// if its status hasn't been checked since the proxy started.
+func (g *gcpController) status(ctx context.Context) serverStatus {
+	g.mu.RLock()
+	known := g.lastStatus != ""
+	inst := g.config.instances()[g.activeInstance]
+	g.mu.RUnlock()
+
+	if !known {
+		status := g.currentStatus(ctx, inst)
+		g.mu.Lock()
+		if g.lastStatus == "" && status != statusUnknown {
+			g.lastStatus = status
+		}
+		g.mu.Unlock()
+	}
+
+	g.mu.RLock()
+	s := serverStatus{
+		server:   g.config.ServerAddress,
+		status:   g.lastStatus,
+		starting: g.isStarting,
+		players:  g.playerCount,
+	}
+	if s.starting {
+		s.eta = g.bootETA()
+	}
+	if !g.lastStartTime.IsZero() && s.status != statusTerminated && s.status != statusStopped {
+		s.uptime = time.Since(g.lastStartTime)
+	}
+	if g.shutdownTimer != nil && g.shutdownAt.After(time.Now()) {
+		s.shutdownAt = g.shutdownAt
+	}
+	if g.noJoinSafetyTimer != nil && g.safetyShutdownAt.After(time.Now()) {
+		s.safetyShutdownAt = g.safetyShutdownAt
+	}
+	g.mu.RUnlock()
+
+	// Count players connected through other proxy replicas as well
+	if g.coordinator != nil {
+		remote, err := g.coordinator.remoteActivity(ctx, g.config.ServerAddress)
+		if err != nil {
+			g.log.Error(err, "Failed to check other proxy replicas for the server status")
+		} else {
+			s.players += remote.Players
+		}
+	}
+	return s
+}
+
+// extendShutdown postpones the pending idle shutdown by playerCommands.extendMinutes on behalf
+// of a player and returns when the instance is going to be stopped now
+func (g *gcpController) extendShutdown(tr trigger) (time.Time, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	if g.shutdownTimer == nil || !g.shutdownAt.After(now) {
+		return time.Time{}, errNoShutdownPending
+	}
+
+	// Limits apply per calendar day in the local time zone, and are not shared with other replicas
+	if day := now.Format(time.DateOnly); g.extendDay != day || g.extendsByPlayer == nil {
+		g.extendDay = day
+		g.extendsByPlayer = make(map[string]int)
+		g.extendsToday = 0
+	}
+	limits := g.config.PlayerCommands
+	if limits.MaxExtendsPerPlayer > 0 && g.extendsByPlayer[tr.PlayerID] >= limits.MaxExtendsPerPlayer {
+		return time.Time{}, errPlayerExtendLimit
+	}
+	if limits.MaxExtendsPerDay > 0 && g.extendsToday >= limits.MaxExtendsPerDay {
+		return time.Time{}, errServerExtendLimit
+	}
+
+	// The timer may have fired already and be waiting for the lock to stop the instance
+	if !g.shutdownTimer.Stop() {
+		return time.Time{}, errNoShutdownPending
+	}
+	extension := time.Duration(limits.ExtendMinutes) * time.Minute
+	g.shutdownAt = g.shutdownAt.Add(extension)
+	g.shutdownTimer.Reset(g.shutdownAt.Sub(now))
+
+	g.extendsByPlayer[tr.PlayerID]++
+	g.extendsToday++
+	g.notifyActivity()
+
+	g.log.Info("Postponed scheduled server shutdown",
+		"player", tr.Player,
+		"extension", extension,
+		"shutdownAt", g.shutdownAt)
+	g.audit(auditShutdownExtended, tr, auditRecord{
+		DurationSeconds: extension.Seconds(),
+	})
+	return g.shutdownAt, nil
+}
+
+// managedServer returns the controller of the managed server with the given name
+func (g *gcpController) managedServer(name string) (*gcpController, error) {
+	for _, controller := range g.servers {
+		if controller.config.ServerAddress == name {
+			return controller, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown managed server %s", name)
+}
+
+// serverStatusCommand creates the /serverstatus command
+func (g *gcpController) serverStatusCommand() brigodier.LiteralNodeBuilder {
+	showStatus := command.Command(func(ctx *command.Context) error {
+		controllers := g.servers
+		if name := ctx.String("server"); name != "" {
+			controller, err := g.managedServer(name)
+			if err != nil {
+				return ctx.Source.SendMessage(&c.Text{
+					Content: fmt.Sprintf("%s is not a managed server.", name),
+					S:       c.Style{Color: color.Red},
+				})
+			}
+			controllers = []*gcpController{controller}
+		}
+
+		message := &c.Text{}
+		for i, controller := range controllers {
+			checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			s := controller.status(checkCtx)
+			cancel()
+
+			if i > 0 {
+				message.Extra = append(message.Extra, &c.Text{Content: "\n"})
+			}
+			message.Extra = append(message.Extra, formatServerStatus(s, g.config.PlayerCommands.Extend)...)
+		}
+		return ctx.Source.SendMessage(message)
+	})
+
+	return brigodier.Literal("serverstatus").
+		Executes(showStatus).
+		Then(brigodier.Argument("server", brigodier.StringWord).Executes(showStatus))
+}
+
+// formatServerStatus formats the status of a managed server for chat. extendable adds a hint
+// to /extend to a pending idle shutdown.
+func formatServerStatus(s serverStatus, extendable bool) []c.Component {
+	state, stateColor := "stopped", color.Red
+	switch {
+	case s.starting:
+		state, stateColor = fmt.Sprintf("starting, ready in about %s", formatDuration(s.eta)), color.Yellow
+	case s.status == statusRunning:
+		state, stateColor = "online", color.Green
+	case s.status == "" || s.status == statusUnknown:
+		state, stateColor = "unknown", color.Gray
+	case s.status != statusTerminated && s.status != statusStopped:
+		state, stateColor = fmt.Sprintf("busy (%s)", strings.ToLower(s.status)), color.Yellow
+	}
+
+	components := []c.Component{
+		&c.Text{
+			Content: s.server + ": ",
+			S:       c.Style{Color: color.Gold, Bold: c.True},
+		},
+		&c.Text{
+			Content: state,
+			S:       c.Style{Color: stateColor},
+		},
+	}
+	if s.status != statusRunning && !s.starting {
+		return components
+	}
+
+	details := fmt.Sprintf("\n  %d %s online", s.players, pluralize(s.players, "player", "players"))
+	if s.uptime > 0 {
+		details += ", up for " + formatDuration(s.uptime)
+	}
+	switch {
+	case !s.shutdownAt.IsZero():
+		details += fmt.Sprintf("\n  Idle shutdown in %s", formatDuration(time.Until(s.shutdownAt)))
+		if extendable {
+			details += ", use /extend to postpone it"
+		}
+	case !s.safetyShutdownAt.IsZero():
+		details += fmt.Sprintf("\n  Stops in %s unless somebody joins", formatDuration(time.Until(s.safetyShutdownAt)))
+	}
+	return append(components, &c.Text{
+		Content: details,
+		S:       c.Style{Color: color.Gray},
+	})
+}
+
+// extendCommand creates the /extend command
+func (g *gcpController) extendCommand() brigodier.LiteralNodeBuilder {
+	extend := command.Command(func(ctx *command.Context) error {
+		player, ok := ctx.Source.(proxy.Player)
+		if !ok {
+			return ctx.Source.SendMessage(&c.Text{
+				Content: "This command can only be executed by players.",
+				S:       c.Style{Color: color.Red},
+			})
+		}
+
+		controller, err := g.extendTarget(ctx.String("server"))
+		if err != nil {
+			return player.SendMessage(&c.Text{
+				Content: "Can't extend: " + err.Error() + ".",
+				S:       c.Style{Color: color.Red},
+			})
+		}
+
+		shutdownAt, err := controller.extendShutdown(trigger{
+			Player:   player.Username(),
+			PlayerID: player.ID().String(),
+			Reason:   "player_extend",
+		})
+		var reply string
+		switch {
+		case errors.Is(err, errNoShutdownPending):
+			reply = fmt.Sprintf("%s is not about to shut down.", controller.config.ServerAddress)
+		case errors.Is(err, errPlayerExtendLimit):
+			reply = fmt.Sprintf("You can't extend %s again today.", controller.config.ServerAddress)
+		case errors.Is(err, errServerExtendLimit):
+			reply = fmt.Sprintf("%s can't be extended again today.", controller.config.ServerAddress)
+		}
+		if reply != "" {
+			return player.SendMessage(&c.Text{
+				Content: reply,
+				S:       c.Style{Color: color.Red},
+			})
+		}
+
+		return player.SendMessage(&c.Text{
+			Content: fmt.Sprintf("Postponed the shutdown of %s by %d minutes, it stops in %s unless somebody joins.",
+				controller.config.ServerAddress, g.config.PlayerCommands.ExtendMinutes,
+				formatDuration(time.Until(shutdownAt))),
+			S: c.Style{Color: color.Green},
+		})
+	})
+
+	return brigodier.Literal("extend").
+		Executes(extend).
+		Then(brigodier.Argument("server", brigodier.StringWord).Executes(extend))
+}
+
+// extendTarget returns the managed server /extend applies to: the named one, or the only one
+// with a pending idle shutdown
+func (g *gcpController) extendTarget(name string) (*gcpController, error) {
+	if name != "" {
+		controller, err := g.managedServer(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a managed server", name)
+		}
+		return controller, nil
+	}
+	if len(g.servers) == 1 {
+		return g.servers[0], nil
+	}
+
+	var pending []*gcpController
+	for _, controller := range g.servers {
+		controller.mu.RLock()
+		if controller.shutdownTimer != nil && controller.shutdownAt.After(time.Now()) {
+			pending = append(pending, controller)
+		}
+		controller.mu.RUnlock()
+	}
+	switch len(pending) {
+	case 0:
+		return nil, fmt.Errorf("no server is about to shut down")
+	case 1:
+		return pending[0], nil
+	default:
+		return nil, fmt.Errorf("several servers are about to shut down, use /extend <server>")
+	}
+}
+
+// pluralize returns singular if n is 1, plural otherwise
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
@@ -0,0 +1,53 @@
+package gcpcontroller
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExtendShutdown(t *testing.T) {
+	g, _ := newTestController(t, statusRunning, func(c *Config) {
+		c.PlayerCommands = PlayerCommandsConfig{
+			Extend:              true,
+			ExtendMinutes:       15,
+			MaxExtendsPerPlayer: 1,
+			MaxExtendsPerDay:    2,
+		}
+	})
+	alice := trigger{Player: "alice", PlayerID: "a", Reason: "player_extend"}
+	bob := trigger{Player: "bob", PlayerID: "b", Reason: "player_extend"}
+	carol := trigger{Player: "carol", PlayerID: "c", Reason: "player_extend"}
+
+	if _, err := g.extendShutdown(alice); !errors.Is(err, errNoShutdownPending) {
+		t.Fatalf("extend without pending shutdown: err = %v, want %v", err, errNoShutdownPending)
+	}
+
+	g.mu.Lock()
+	g.scheduleShutdown(trigger{Reason: "last_player_left"})
+	scheduled := g.shutdownAt
+	g.mu.Unlock()
+
+	shutdownAt, err := g.extendShutdown(alice)
+	if err != nil {
+		t.Fatalf("extendShutdown: %v", err)
+	}
+	if got := shutdownAt.Sub(scheduled); got != 15*time.Minute {
+		t.Errorf("shutdown postponed by %v, want 15m", got)
+	}
+
+	if _, err := g.extendShutdown(alice); !errors.Is(err, errPlayerExtendLimit) {
+		t.Errorf("second extend by the same player: err = %v, want %v", err, errPlayerExtendLimit)
+	}
+	if _, err := g.extendShutdown(bob); err != nil {
+		t.Errorf("extend by another player: %v", err)
+	}
+	if _, err := g.extendShutdown(carol); !errors.Is(err, errServerExtendLimit) {
+		t.Errorf("extend beyond the daily limit: err = %v, want %v", err, errServerExtendLimit)
+	}
+
+	events := auditEvents(t, g)
+	if n := len(events); n != 3 || events[1] != auditShutdownExtended || events[2] != auditShutdownExtended {
+		t.Errorf("audit events = %v, want shutdown scheduled and extended twice", events)
+	}
+}
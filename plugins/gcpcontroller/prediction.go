@@ -0,0 +1,233 @@
+package gcpcontroller
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// reasonPredictedJoin is the trigger reason of starts ahead of a session predicted from the join history
+const reasonPredictedJoin = "predicted_join"
+
+// Timing of the prediction loop: how often it looks ahead, and how often the join history
+// is learned again from the audit log
+const (
+	predictionInterval = time.Minute
+	predictionRelearn  = time.Hour
+)
+
+// PredictionConfig configures starting the instance shortly before players usually join
+type PredictionConfig struct {
+	Enabled bool
+	// LeadMinutes is how long before the hour of a likely session the instance is started
+	LeadMinutes int
+	// Threshold is the share of past weeks with a session starting in the same hour of the week
+	// needed to start the instance, from 0 to 1
+	Threshold float64
+	// LookbackWeeks is how many weeks of the audit log the join history is learned from
+	LookbackWeeks int
+	// MinWeeks is how many weeks of history are needed before starts are predicted
+	MinWeeks int
+	// MaxSpeculativeMinutes replaces noJoinTimeoutMinutes for predicted starts: the instance is
+	// stopped if nobody joined within this time
+	MaxSpeculativeMinutes int
+	// Timezone is the IANA time zone the weekdays and hours are counted in (default: local time)
+	Timezone string
+
+	location *time.Location // loaded from Timezone
+}
+
+// validate checks the prediction settings and loads the time zone
+func (c *PredictionConfig) validate() error {
+	c.location = time.Local
+	if !c.Enabled {
+		return nil
+	}
+	if c.LeadMinutes < 0 || c.LeadMinutes > 60 {
+		return fmt.Errorf("gcpController.prediction.leadMinutes must be between 0 and 60")
+	}
+	if c.Threshold <= 0 || c.Threshold > 1 {
+		return fmt.Errorf("gcpController.prediction.threshold must be greater than 0 and at most 1")
+	}
+	if c.LookbackWeeks < 1 {
+		return fmt.Errorf("gcpController.prediction.lookbackWeeks must be at least 1")
+	}
+	if c.MinWeeks < 1 || c.MinWeeks > c.LookbackWeeks {
+		return fmt.Errorf("gcpController.prediction.minWeeks must be between 1 and lookbackWeeks")
+	}
+	if c.MaxSpeculativeMinutes < 1 {
+		return fmt.Errorf("gcpController.prediction.maxSpeculativeMinutes must be at least 1")
+	}
+	if c.Timezone != "" {
+		loc, err := time.LoadLocation(c.Timezone)
+		if err != nil {
+			return fmt.Errorf("gcpController.prediction.timezone %q is invalid: %w", c.Timezone, err)
+		}
+		c.location = loc
+	}
+	return nil
+}
+
+// joinHistogram counts in how many weeks a session started in each hour of the week
+type joinHistogram struct {
+	// sessions counts the weeks with a first join, occurrences how often the hour was part of the
+	// learned period, both by weekday and hour
+	sessions    [7][24]int
+	occurrences [7][24]int
+	weeks       float64 // length of the learned period
+}
+
+// buildJoinHistogram learns the join history of a server from the audit records between from and to.
+// A session starts with the first player who requested a start or joined after the instance was
+// started. Records without a server belong to the first server.
+func buildJoinHistogram(records []auditRecord, server string, primary bool, from, to time.Time, loc *time.Location) *joinHistogram {
+	h := &joinHistogram{}
+
+	// The history may be shorter than the lookback, e.g. after the plugin was installed
+	for _, rec := range records {
+		if rec.Server != server && (rec.Server != "" || !primary) {
+			continue
+		}
+		if rec.Time.After(from) {
+			from = rec.Time
+		}
+		break
+	}
+	if !to.After(from) {
+		return h
+	}
+	h.weeks = to.Sub(from).Hours() / (24 * 7)
+
+	for hour := startOfHour(from.In(loc)); hour.Before(to); hour = hour.Add(time.Hour) {
+		h.occurrences[hour.Weekday()][hour.Hour()]++
+	}
+
+	counted := false // the session of the current run of the instance has been counted
+	seen := make(map[string]bool)
+	for _, rec := range records {
+		if rec.Server != server && (rec.Server != "" || !primary) {
+			continue
+		}
+		if rec.Time.After(to) {
+			break
+		}
+
+		switch rec.Event {
+		case auditStartRequested:
+			// A new run, its session starts with the player who requested it, if any
+			counted = false
+			if rec.Player == "" {
+				continue
+			}
+		case auditFirstJoin:
+		case auditStop, auditSafetyShutdown:
+			counted = false
+			continue
+		default:
+			continue
+		}
+		if counted {
+			continue
+		}
+		counted = true
+		if rec.Time.Before(from) {
+			continue
+		}
+
+		// Several sessions in the same hour count once
+		t := rec.Time.In(loc)
+		key := t.Format("2006-01-02T15")
+		if !seen[key] {
+			seen[key] = true
+			h.sessions[t.Weekday()][t.Hour()]++
+		}
+	}
+	return h
+}
+
+// confidence returns the share of weeks in which a session started in the hour of the week of t
+func (h *joinHistogram) confidence(t time.Time) float64 {
+	occurrences := h.occurrences[t.Weekday()][t.Hour()]
+	if occurrences == 0 {
+		return 0
+	}
+	return min(1, float64(h.sessions[t.Weekday()][t.Hour()])/float64(occurrences))
+}
+
+// startOfHour returns the start of the hour of t in its location
+func startOfHour(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+}
+
+// predictor starts the instance ahead of sessions that are likely according to the join history
+type predictor struct {
+	g         *gcpController
+	histogram *joinHistogram
+	learnedAt time.Time
+	lastHour  time.Time // hour of the week that was last checked
+}
+
+// predictStarts checks once a minute whether a session is likely soon, until ctx is done
+func (g *gcpController) predictStarts(ctx context.Context) {
+	p := &predictor{g: g}
+
+	ticker := time.NewTicker(predictionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.check(ctx, now)
+		}
+	}
+}
+
+// check starts the instance if now is leadMinutes before an hour in which a session is likely.
+// Every hour is checked once, so a stopped speculative start isn't repeated.
+func (p *predictor) check(ctx context.Context, now time.Time) {
+	g := p.g
+	config := g.config.Prediction
+
+	if p.histogram == nil || now.Sub(p.learnedAt) >= predictionRelearn {
+		records, err := g.auditLog.all()
+		if err != nil {
+			g.log.Error(err, "Failed to read audit log for the join history")
+			return
+		}
+		lookback := time.Duration(config.LookbackWeeks) * 7 * 24 * time.Hour
+		primary := g.servers[0] == g
+		p.histogram = buildJoinHistogram(records, g.config.ServerAddress, primary, now.Add(-lookback), now, config.location)
+		p.learnedAt = now
+	}
+	if p.histogram.weeks < float64(config.MinWeeks) {
+		return
+	}
+
+	hour := startOfHour(now.Add(time.Duration(config.LeadMinutes) * time.Minute).In(config.location))
+	if hour.Equal(p.lastHour) {
+		return
+	}
+	p.lastHour = hour
+
+	confidence := p.histogram.confidence(hour)
+	if confidence < config.Threshold {
+		return
+	}
+
+	server := g.proxy.Server(g.config.ServerAddress)
+	if server != nil && g.cachedReady(server) {
+		return
+	}
+
+	g.log.Info("Starting GCP instance ahead of a likely session",
+		"sessionAt", hour,
+		"confidence", confidence,
+		"threshold", config.Threshold)
+
+	startCtx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+	if _, err := g.tryStartServer(startCtx, trigger{Reason: reasonPredictedJoin}); err != nil {
+		g.log.Error(err, "Failed to start GCP instance ahead of a likely session")
+	}
+}
@@ -0,0 +1,154 @@
+package gcpcontroller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/minekube/gate-plugin-template/plugins/gcpcontroller/internal/fakecompute"
+)
+
+// sessionRecords returns the audit records of a weekly session starting at the given time on the
+// last weeks before now: a player requests the start, later another player joins first.
+func sessionRecords(now time.Time, weeks int, weekday time.Weekday, hour, minute int) []auditRecord {
+	var records []auditRecord
+	for week := weeks; week >= 1; week-- {
+		day := now.AddDate(0, 0, -7*week)
+		day = day.AddDate(0, 0, int(weekday-day.Weekday()))
+		at := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, time.UTC)
+		records = append(records,
+			auditRecord{Time: at, Event: auditStartRequested, Player: "Steve", Server: testServer},
+			auditRecord{Time: at.Add(3 * time.Minute), Event: auditFirstJoin, Player: "Alex", Server: testServer},
+			auditRecord{Time: at.Add(2 * time.Hour), Event: auditStop, Server: testServer},
+		)
+	}
+	return records
+}
+
+func TestBuildJoinHistogram(t *testing.T) {
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC) // a Monday
+	records := sessionRecords(now, 4, time.Friday, 19, 10)
+	// A predicted start is counted by its first join, a second session in the same hour only once
+	records = append(records,
+		auditRecord{Time: now.AddDate(0, 0, -2).Add(-2 * time.Hour), Event: auditStartRequested, Reason: reasonPredictedJoin, Server: testServer},
+		auditRecord{Time: now.AddDate(0, 0, -2).Add(-90 * time.Minute), Event: auditFirstJoin, Player: "Steve", Server: testServer},
+		auditRecord{Time: now.AddDate(0, 0, -2).Add(-60 * time.Minute), Event: auditStop, Server: testServer},
+		auditRecord{Time: now.AddDate(0, 0, -2).Add(-55 * time.Minute), Event: auditStartRequested, Player: "Steve", Server: testServer},
+		// Other servers don't count
+		auditRecord{Time: now.AddDate(0, 0, -1), Event: auditStartRequested, Player: "Steve", Server: "other"},
+	)
+
+	h := buildJoinHistogram(records, testServer, true, now.AddDate(0, 0, -8*7), now, time.UTC)
+	// The history starts with the first session, on a Friday 4 weeks ago
+	if h.weeks < 3.3 || h.weeks > 3.5 {
+		t.Errorf("weeks = %.2f, want the length of the history", h.weeks)
+	}
+	friday := time.Date(2024, 6, 7, 19, 0, 0, 0, time.UTC)
+	if c := h.confidence(friday); c != 1 {
+		t.Errorf("confidence Friday 19:00 = %.2f, want 1", c)
+	}
+	if c := h.confidence(friday.Add(-time.Hour)); c != 0 {
+		t.Errorf("confidence Friday 18:00 = %.2f, want 0", c)
+	}
+	saturday := time.Date(2024, 6, 8, 10, 0, 0, 0, time.UTC)
+	if c := h.confidence(saturday); c != 0.25 {
+		t.Errorf("confidence Saturday 10:00 = %.2f, want 0.25", c)
+	}
+	if c := h.confidence(time.Date(2024, 6, 2, 10, 0, 0, 0, time.UTC)); c != 0 {
+		t.Errorf("confidence Sunday 10:00 = %.2f, want 0", c)
+	}
+}
+
+func TestPredictedStart(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, func(c *Config) {
+		c.Prediction = PredictionConfig{
+			Enabled:               true,
+			LeadMinutes:           10,
+			Threshold:             0.5,
+			LookbackWeeks:         8,
+			MinWeeks:              2,
+			MaxSpeculativeMinutes: 20,
+			Timezone:              "UTC",
+		}
+	})
+	g.servers = []*gcpController{g}
+	if err := g.config.Prediction.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	now := time.Now().UTC()
+	for _, rec := range sessionRecords(now, 3, now.Add(10*time.Minute).Weekday(), now.Add(10*time.Minute).Hour(), 0) {
+		if err := g.auditLog.append(rec); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	p := &predictor{g: g}
+	p.check(context.Background(), now)
+	if n := fake.Requests(fakecompute.ActionStart); n != 1 {
+		t.Fatalf("start requests = %d, want 1", n)
+	}
+
+	g.mu.RLock()
+	safetyIn := time.Until(g.safetyShutdownAt)
+	g.mu.RUnlock()
+	if safetyIn > 20*time.Minute || safetyIn < 19*time.Minute {
+		t.Errorf("safety shutdown in %s, want maxSpeculativeMinutes", safetyIn)
+	}
+
+	// The same hour is only checked once
+	p.check(context.Background(), now.Add(time.Minute))
+	if n := fake.Requests(fakecompute.ActionStart); n != 1 {
+		t.Errorf("start requests = %d, want 1", n)
+	}
+}
+
+func TestPredictionUsesReadinessCache(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, func(c *Config) {
+		c.Prediction = PredictionConfig{Enabled: true, LeadMinutes: 10, Threshold: 0.5, LookbackWeeks: 8, MinWeeks: 2, MaxSpeculativeMinutes: 20, Timezone: "UTC"}
+		c.Readiness.MaxAgeSeconds = 60
+	})
+	g.servers = []*gcpController{g}
+	if err := g.config.Prediction.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	now := time.Now().UTC()
+	for _, rec := range sessionRecords(now, 3, now.Add(10*time.Minute).Weekday(), now.Add(10*time.Minute).Hour(), 0) {
+		if err := g.auditLog.append(rec); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	// Nothing listens on the server's port, so only the background probe's result reports it as ready
+	g.readyCache = newReadinessCache()
+	g.readyCache.store(g.readyCache.begin(), true)
+
+	p := &predictor{g: g}
+	p.check(context.Background(), now)
+	if n := fake.Requests(fakecompute.ActionStart); n != 0 {
+		t.Errorf("start requests = %d, want 0 for a server the cache reports as ready", n)
+	}
+}
+
+func TestPredictionWithoutHistory(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, func(c *Config) {
+		c.Prediction = PredictionConfig{Enabled: true, LeadMinutes: 10, Threshold: 0.5, LookbackWeeks: 8, MinWeeks: 2, MaxSpeculativeMinutes: 20}
+	})
+	g.servers = []*gcpController{g}
+	if err := g.config.Prediction.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+
+	now := time.Now()
+	for _, rec := range sessionRecords(now, 1, now.Add(10*time.Minute).Weekday(), now.Add(10*time.Minute).Hour(), 0) {
+		if err := g.auditLog.append(rec); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	(&predictor{g: g}).check(context.Background(), now)
+	if n := fake.Requests(fakecompute.ActionStart); n != 0 {
+		t.Errorf("start requests = %d, want 0 with less than minWeeks of history", n)
+	}
+}
@@ -0,0 +1,179 @@
+package gcpcontroller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// prewarmCooldown is the minimum time between two pre-warm attempts, so that
+// frequent status pings don't cause an instance lookup each
+const prewarmCooldown = time.Minute
+
+// PrewarmConfig configures starting the instance before a player connects to the managed server
+type PrewarmConfig struct {
+	// OnLogin starts the instance when a whitelisted player logs into the proxy
+	OnLogin bool
+	// OnPing starts the instance on a status ping from an IP a whitelisted player recently logged in from
+	OnPing bool
+	// PingMemoryHours is how long the IP of a whitelisted player is remembered for OnPing
+	PingMemoryHours int
+	// WhitelistEnabled and WhitelistFile mirror the whitelist plugin's settings
+	WhitelistEnabled bool
+	WhitelistFile    string
+}
+
+// knownIP is an IP a whitelisted player logged in from
+type knownIP struct {
+	Player   string
+	PlayerID string
+	LastSeen time.Time
+}
+
+// onPostLogin pre-warms the instance when a whitelisted player logs into the proxy
+func (g *gcpController) onPostLogin(e *proxy.PostLoginEvent) {
+	player := e.Player()
+	uuid := player.ID().String()
+
+	if !g.acceptsVirtualHost(player.VirtualHost()) {
+		return
+	}
+
+	whitelisted, err := g.isWhitelisted(uuid)
+	if err != nil {
+		g.log.Error(err, "Failed to read whitelist for pre-warming")
+		return
+	}
+	if !whitelisted {
+		return
+	}
+
+	// Remember the player's IP for pre-warming on status pings
+	if ip := hostOf(player.RemoteAddr()); g.config.Prewarm.OnPing && ip != "" {
+		g.mu.Lock()
+		g.knownIPs[ip] = knownIP{
+			Player:   player.Username(),
+			PlayerID: uuid,
+			LastSeen: time.Now(),
+		}
+		g.mu.Unlock()
+	}
+
+	if !g.config.Prewarm.OnLogin {
+		return
+	}
+
+	g.prewarm(trigger{
+		Player:   player.Username(),
+		PlayerID: uuid,
+		Reason:   "prewarm_login",
+		Profile:  g.virtualHostProfile(player.VirtualHost()),
+	})
+}
+
+// onPing pre-warms the instance on a status ping from an IP a whitelisted player recently used
+func (g *gcpController) onPing(e *proxy.PingEvent) {
+	if !g.acceptsVirtualHost(e.Connection().VirtualHost()) {
+		return
+	}
+
+	ip := hostOf(e.Connection().RemoteAddr())
+	if ip == "" {
+		return
+	}
+
+	memory := time.Duration(g.config.Prewarm.PingMemoryHours) * time.Hour
+
+	g.mu.Lock()
+	known, ok := g.knownIPs[ip]
+	if ok && time.Since(known.LastSeen) > memory {
+		delete(g.knownIPs, ip)
+		ok = false
+	}
+	g.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	g.prewarm(trigger{
+		Player:   known.Player,
+		PlayerID: known.PlayerID,
+		Reason:   "prewarm_ping",
+		Profile:  g.virtualHostProfile(e.Connection().VirtualHost()),
+	})
+}
+
+// prewarm starts the instance in the background unless it is already ready
+func (g *gcpController) prewarm(tr trigger) {
+	g.mu.Lock()
+	if time.Since(g.lastPrewarm) < prewarmCooldown {
+		g.mu.Unlock()
+		return
+	}
+	g.lastPrewarm = time.Now()
+	g.mu.Unlock()
+
+	// Run in new goroutine to unblock the login/ping event handler
+	go func() {
+		server := g.proxy.Server(g.config.ServerAddress)
+		if server == nil || g.cachedReady(server) {
+			return
+		}
+
+		g.log.Info("Pre-warming GCP instance",
+			"player", tr.Player,
+			"reason", tr.Reason)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+		defer cancel()
+
+		if _, err := g.tryStartServer(ctx, tr); err != nil {
+			g.log.Error(err, "Failed to pre-warm GCP instance")
+		}
+	}()
+}
+
+// isWhitelisted checks if a player may join according to the whitelist plugin's settings.
+// The whitelist file is read on every call, so changes made with /whitelist are picked up.
+func (g *gcpController) isWhitelisted(uuid string) (bool, error) {
+	if !g.config.Prewarm.WhitelistEnabled {
+		return true, nil
+	}
+
+	data, err := os.ReadFile(g.config.Prewarm.WhitelistFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to read whitelist file: %w", err)
+	}
+
+	var entries []struct {
+		UUID string `json:"uuid"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return false, fmt.Errorf("failed to parse whitelist file: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.UUID == uuid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// hostOf returns the IP of a remote address, or an empty string if it has none
+func hostOf(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
@@ -0,0 +1,138 @@
+package gcpcontroller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// readinessCache is the last result of the readiness probe of a managed server, kept up to date by
+// probeReadiness so connecting players don't wait for a probe
+type readinessCache struct {
+	mu         sync.Mutex
+	ready      bool
+	checkedAt  time.Time // zero if the result is unknown
+	generation int       // incremented by invalidate, so probes started before are discarded
+
+	wake chan struct{} // asks the prober to probe right away
+}
+
+func newReadinessCache() *readinessCache {
+	return &readinessCache{wake: make(chan struct{}, 1)}
+}
+
+// get returns the cached result if it was checked within maxAge
+func (c *readinessCache) get(maxAge time.Duration) (ready, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checkedAt.IsZero() || time.Since(c.checkedAt) > maxAge {
+		return false, false
+	}
+	return c.ready, true
+}
+
+// begin returns the generation a probe's result is stored for
+func (c *readinessCache) begin() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// store saves the result of a probe, unless the cache was invalidated since the probe began
+func (c *readinessCache) store(generation int, ready bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	c.ready = ready
+	c.checkedAt = time.Now()
+}
+
+// invalidate drops the cached result, e.g. after the instance was started or stopped, and wakes
+// the prober
+func (c *readinessCache) invalidate() {
+	c.mu.Lock()
+	c.generation++
+	c.checkedAt = time.Time{}
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// probeReady checks whether the server is ready and caches the result
+func (g *gcpController) probeReady(server proxy.RegisteredServer) bool {
+	c := g.readyCache
+	if c == nil {
+		return g.isServerReady(server)
+	}
+	generation := c.begin()
+	ready := g.isServerReady(server)
+	c.store(generation, ready)
+	return ready
+}
+
+// cachedReady returns whether the server is ready from the cache, and only probes it if the
+// cached result is older than readiness.maxAgeSeconds or unknown
+func (g *gcpController) cachedReady(server proxy.RegisteredServer) bool {
+	if c := g.readyCache; c != nil {
+		maxAge := time.Duration(g.config.Readiness.MaxAgeSeconds) * time.Second
+		if ready, ok := c.get(maxAge); ok {
+			return ready
+		}
+	}
+	return g.probeReady(server)
+}
+
+// invalidateReadiness makes the next connection probe the server again, after its instance was
+// started, stopped or recovered
+func (g *gcpController) invalidateReadiness() {
+	if g.readyCache != nil {
+		g.readyCache.invalidate()
+	}
+}
+
+// probeReadiness probes the server in the background until ctx is done, every
+// readiness.probeIntervalSeconds and every readiness.startingProbeIntervalSeconds while it boots
+func (g *gcpController) probeReadiness(ctx context.Context) {
+	c := g.readyCache
+	readiness := g.config.Readiness
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-timer.C:
+		}
+
+		if server := g.proxy.Server(g.config.ServerAddress); server != nil {
+			g.probeReady(server)
+		} else {
+			c.store(c.begin(), false)
+		}
+
+		g.mu.RLock()
+		starting := g.isStarting || g.pendingStart
+		g.mu.RUnlock()
+
+		interval := readiness.ProbeIntervalSeconds
+		if starting {
+			interval = readiness.StartingProbeIntervalSeconds
+		}
+		timer.Reset(time.Duration(interval) * time.Second)
+	}
+}
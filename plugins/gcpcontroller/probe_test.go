@@ -0,0 +1,62 @@
+package gcpcontroller
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCachedReady(t *testing.T) {
+	g, _ := newTestController(t, statusRunning, func(c *Config) {
+		c.Readiness.MaxAgeSeconds = 30
+	})
+	g.readyCache = newReadinessCache()
+	server := g.proxy.Server(testServer)
+
+	// Nothing listens on the server's port, so only the cache can report it as ready
+	g.readyCache.store(g.readyCache.begin(), true)
+	if !g.cachedReady(server) {
+		t.Error("cachedReady = false, want cached true")
+	}
+
+	g.invalidateReadiness()
+	if g.cachedReady(server) {
+		t.Error("cachedReady after invalidate = true, want probed false")
+	}
+	if ready, ok := g.readyCache.get(time.Minute); !ok || ready {
+		t.Errorf("cache after probe = %v, %v, want false, true", ready, ok)
+	}
+
+	// A probe that began before the cache was invalidated is discarded
+	generation := g.readyCache.begin()
+	g.invalidateReadiness()
+	g.readyCache.store(generation, true)
+	if _, ok := g.readyCache.get(time.Minute); ok {
+		t.Error("result of a probe older than the invalidation was cached")
+	}
+}
+
+func TestProbeReadiness(t *testing.T) {
+	g, _ := newTestController(t, statusRunning, func(c *Config) {
+		c.Readiness.ProbeIntervalSeconds = 60
+		c.Readiness.StartingProbeIntervalSeconds = 60
+	})
+	g.readyCache = newReadinessCache()
+	g.readyCache.store(g.readyCache.begin(), true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go g.probeReadiness(ctx)
+
+	// The first probe runs right away, later ones after a wake-up
+	waitFor(t, "first probe", func() bool {
+		ready, ok := g.readyCache.get(time.Minute)
+		return ok && !ready
+	})
+	g.readyCache.store(g.readyCache.begin(), true)
+	g.invalidateReadiness()
+	waitFor(t, "probe after invalidate", func() bool {
+		ready, ok := g.readyCache.get(time.Minute)
+		return ok && !ready
+	})
+}
@@ -0,0 +1,525 @@
+package gcpcontroller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	compute "cloud.google.com/go/compute/apiv1"
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"github.com/go-logr/logr"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// Instance status values as reported by the Compute Engine API
+const (
+	statusStaging    = "STAGING"
+	statusRunning    = "RUNNING"
+	statusStopping   = "STOPPING"
+	statusStopped    = "STOPPED"
+	statusTerminated = "TERMINATED"
+	statusSuspended  = "SUSPENDED"
+	// statusUnknown is used when the status of an instance could not be read
+	statusUnknown = "UNKNOWN"
+)
+
+// operationPollInterval is how often a pending zone operation is polled
+const operationPollInterval = 5 * time.Second
+
+// Supported values for the provider setting
+const (
+	providerGCP       = "gcp"
+	providerSimulated = "simulated"
+)
+
+// capacityErrorCodes are the GCE error codes returned when a zone cannot provide the
+// resources to start an instance. Starts failing with one of these are retried on the
+// next fallback instance.
+var capacityErrorCodes = []string{
+	"ZONE_RESOURCE_POOL_EXHAUSTED",
+	"ZONE_RESOURCE_POOL_EXHAUSTED_WITH_DETAILS",
+}
+
+// Supported values for the addressSource setting
+const (
+	addressSourceInternal = "internal"
+	addressSourceExternal = "external"
+)
+
+// instanceInfo is the current state of an instance
+type instanceInfo struct {
+	Status     string // e.g. RUNNING, TERMINATED
+	InternalIP string // IP of the first network interface, empty if unknown
+	ExternalIP string // external IP of the first access config, empty if the instance has none
+}
+
+// ip returns the instance IP for the given address source
+func (i *instanceInfo) ip(source string) (string, error) {
+	ip := i.InternalIP
+	if source == addressSourceExternal {
+		ip = i.ExternalIP
+	}
+	if ip == "" {
+		return "", fmt.Errorf("instance has no %s IP", source)
+	}
+	return ip, nil
+}
+
+// instanceProvider abstracts the backend that hosts the managed server instances
+type instanceProvider interface {
+	// Get returns the current state of the instance
+	Get(ctx context.Context, inst InstanceConfig) (*instanceInfo, error)
+	// Start requests the instance to start and returns the name of the zone operation,
+	// or an empty name if there is nothing to wait for
+	Start(ctx context.Context, inst InstanceConfig) (string, error)
+	// Stop requests the instance to stop and returns the name of the zone operation,
+	// or an empty name if there is nothing to wait for
+	Stop(ctx context.Context, inst InstanceConfig) (string, error)
+	// Reset hard-resets a running instance, like pressing its reset button, and returns the name
+	// of the zone operation
+	Reset(ctx context.Context, inst InstanceConfig) (string, error)
+	// WaitOperation waits until a zone operation is done and returns the error it failed with
+	WaitOperation(ctx context.Context, inst InstanceConfig, operation string) error
+	// ReadinessSignal returns the value of the guest attribute or metadata key (depending on
+	// source) the VM sets once it is ready. found is false if the key is not set.
+	ReadinessSignal(ctx context.Context, inst InstanceConfig, source, key string) (value string, found bool, err error)
+	// SetLabels merges labels into the instance's labels
+	SetLabels(ctx context.Context, inst InstanceConfig, labels map[string]string) error
+	// SetMetadata merges items into the instance's metadata
+	SetMetadata(ctx context.Context, inst InstanceConfig, items map[string]string) error
+	// RemoveMetadata deletes keys from the instance's metadata, keys that are not set are ignored
+	RemoveMetadata(ctx context.Context, inst InstanceConfig, keys []string) error
+	// SerialPortOutput returns the recent output of the instance's first serial port, which
+	// shows the boot log and the output of startup scripts
+	SerialPortOutput(ctx context.Context, inst InstanceConfig) (string, error)
+	// MissingPermissions returns the permissions on the instance the credentials don't have
+	MissingPermissions(ctx context.Context, inst InstanceConfig, permissions []string) ([]string, error)
+}
+
+// isNotFound reports whether an API call failed because the resource does not exist
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// isFingerprintConflict reports whether an update failed because the fingerprint was outdated,
+// i.e. the labels or metadata were changed by someone else since they were read
+func isFingerprintConflict(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
+
+// isCapacityError reports whether a start failed because the zone ran out of resources
+func isCapacityError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	for _, code := range capacityErrorCodes {
+		if strings.Contains(msg, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// newProvider creates the instance provider selected in the configuration
+func newProvider(ctx context.Context, config *Config, log logr.Logger) (instanceProvider, error) {
+	if config.Provider == providerSimulated {
+		log.Info("Using simulated provider, no GCP API calls will be made")
+		return newSimulatedProvider(config, log), nil
+	}
+
+	clientOpts, err := clientOptions(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return newGCPProvider(ctx, log, clientOpts...)
+}
+
+// newGCPProvider creates the Compute Engine clients with the given options, e.g. to point
+// them at another endpoint
+func newGCPProvider(ctx context.Context, log logr.Logger, opts ...option.ClientOption) (*gcpProvider, error) {
+	client, err := compute.NewInstancesRESTClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCP compute client: %w", err)
+	}
+
+	groups, err := compute.NewInstanceGroupManagersRESTClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCP instance group client: %w", err)
+	}
+
+	operations, err := compute.NewZoneOperationsRESTClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCP zone operations client: %w", err)
+	}
+
+	return &gcpProvider{
+		client:     client,
+		groups:     groups,
+		operations: operations,
+		log:        log,
+	}, nil
+}
+
+// gcpProvider manages real Compute Engine instances and managed instance groups.
+// Instances with an InstanceGroup are handled by the methods in instancegroup.go.
+type gcpProvider struct {
+	client     *compute.InstancesClient
+	groups     *compute.InstanceGroupManagersClient
+	operations *compute.ZoneOperationsClient
+	log        logr.Logger
+}
+
+// Get returns the current status and IPs of the Compute Engine instance
+func (p *gcpProvider) Get(ctx context.Context, inst InstanceConfig) (*instanceInfo, error) {
+	if inst.InstanceGroup != "" {
+		return p.getGroup(ctx, inst)
+	}
+
+	instance, err := p.client.Get(ctx, &computepb.GetInstanceRequest{
+		Project:  inst.ProjectID,
+		Zone:     inst.Zone,
+		Instance: inst.InstanceName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := &instanceInfo{Status: instance.GetStatus()}
+	if nics := instance.GetNetworkInterfaces(); len(nics) > 0 {
+		info.InternalIP = nics[0].GetNetworkIP()
+		if configs := nics[0].GetAccessConfigs(); len(configs) > 0 {
+			info.ExternalIP = configs[0].GetNatIP()
+		}
+	}
+	return info, nil
+}
+
+// Start starts the Compute Engine instance
+func (p *gcpProvider) Start(ctx context.Context, inst InstanceConfig) (string, error) {
+	if inst.InstanceGroup != "" {
+		return p.startGroup(ctx, inst)
+	}
+
+	p.log.Info("Starting GCP instance",
+		"project", inst.ProjectID,
+		"zone", inst.Zone,
+		"instance", inst.InstanceName)
+
+	op, err := p.client.Start(ctx, &computepb.StartInstanceRequest{
+		Project:  inst.ProjectID,
+		Zone:     inst.Zone,
+		Instance: inst.InstanceName,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to start instance: %w", err)
+	}
+
+	return op.Name(), nil
+}
+
+// Stop stops the Compute Engine instance
+func (p *gcpProvider) Stop(ctx context.Context, inst InstanceConfig) (string, error) {
+	if inst.InstanceGroup != "" {
+		return p.stopGroup(ctx, inst)
+	}
+
+	p.log.Info("Stopping GCP instance",
+		"project", inst.ProjectID,
+		"zone", inst.Zone,
+		"instance", inst.InstanceName)
+
+	op, err := p.client.Stop(ctx, &computepb.StopInstanceRequest{
+		Project:  inst.ProjectID,
+		Zone:     inst.Zone,
+		Instance: inst.InstanceName,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to stop instance: %w", err)
+	}
+
+	return op.Name(), nil
+}
+
+// Reset resets the Compute Engine instance, or the instance its group holds
+func (p *gcpProvider) Reset(ctx context.Context, inst InstanceConfig) (string, error) {
+	inst, err := p.resolveGroupMember(ctx, inst)
+	if err != nil {
+		return "", err
+	}
+
+	p.log.Info("Resetting GCP instance",
+		"project", inst.ProjectID,
+		"zone", inst.Zone,
+		"instance", inst.InstanceName)
+
+	op, err := p.client.Reset(ctx, &computepb.ResetInstanceRequest{
+		Project:  inst.ProjectID,
+		Zone:     inst.Zone,
+		Instance: inst.InstanceName,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to reset instance: %w", err)
+	}
+
+	return op.Name(), nil
+}
+
+// WaitOperation polls a zone operation until it is done
+func (p *gcpProvider) WaitOperation(ctx context.Context, inst InstanceConfig, operation string) error {
+	if operation == "" {
+		return nil
+	}
+
+	ticker := time.NewTicker(operationPollInterval)
+	defer ticker.Stop()
+
+	for {
+		op, err := p.operations.Get(ctx, &computepb.GetZoneOperationRequest{
+			Project:   inst.ProjectID,
+			Zone:      inst.Zone,
+			Operation: operation,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get operation %s: %w", operation, err)
+		}
+		if op.GetStatus() == computepb.Operation_DONE {
+			return operationError(op)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("failed to wait for operation %s: %w", operation, ctx.Err())
+		}
+	}
+}
+
+// operationFailedError is returned by WaitOperation when the operation itself failed,
+// as opposed to polling it
+type operationFailedError struct {
+	msg string
+}
+
+func (e *operationFailedError) Error() string { return e.msg }
+
+// operationError returns the errors of a finished operation, including their GCE error codes
+func operationError(op *computepb.Operation) error {
+	var msgs []string
+	for _, e := range op.GetError().GetErrors() {
+		msgs = append(msgs, e.GetCode()+": "+e.GetMessage())
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return &operationFailedError{
+		msg: fmt.Sprintf("operation %s failed: %s", op.GetName(), strings.Join(msgs, "; ")),
+	}
+}
+
+// ReadinessSignal reads the readiness key from the instance's guest attributes or metadata
+func (p *gcpProvider) ReadinessSignal(ctx context.Context, inst InstanceConfig, source, key string) (string, bool, error) {
+	inst, err := p.resolveGroupMember(ctx, inst)
+	if err != nil {
+		return "", false, err
+	}
+
+	if source == readinessGuestAttribute {
+		attrs, err := p.client.GetGuestAttributes(ctx, &computepb.GetGuestAttributesInstanceRequest{
+			Project:     inst.ProjectID,
+			Zone:        inst.Zone,
+			Instance:    inst.InstanceName,
+			VariableKey: &key,
+		})
+		if err != nil {
+			if isNotFound(err) {
+				return "", false, nil
+			}
+			return "", false, fmt.Errorf("failed to get guest attribute: %w", err)
+		}
+		return attrs.GetVariableValue(), true, nil
+	}
+
+	instance, err := p.client.Get(ctx, &computepb.GetInstanceRequest{
+		Project:  inst.ProjectID,
+		Zone:     inst.Zone,
+		Instance: inst.InstanceName,
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get instance metadata: %w", err)
+	}
+	for _, item := range instance.GetMetadata().GetItems() {
+		if item.GetKey() == key {
+			return item.GetValue(), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// SetLabels merges labels into the instance's labels. If the labels were changed concurrently,
+// the update is retried once with the new fingerprint.
+func (p *gcpProvider) SetLabels(ctx context.Context, inst InstanceConfig, labels map[string]string) error {
+	inst, err := p.resolveGroupMember(ctx, inst)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		instance, err := p.client.Get(ctx, &computepb.GetInstanceRequest{
+			Project:  inst.ProjectID,
+			Zone:     inst.Zone,
+			Instance: inst.InstanceName,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get instance labels: %w", err)
+		}
+
+		merged := make(map[string]string, len(instance.GetLabels())+len(labels))
+		maps.Copy(merged, instance.GetLabels())
+		maps.Copy(merged, labels)
+
+		op, err := p.client.SetLabels(ctx, &computepb.SetLabelsInstanceRequest{
+			Project:  inst.ProjectID,
+			Zone:     inst.Zone,
+			Instance: inst.InstanceName,
+			InstancesSetLabelsRequestResource: &computepb.InstancesSetLabelsRequest{
+				LabelFingerprint: instance.LabelFingerprint,
+				Labels:           merged,
+			},
+		})
+		if err == nil {
+			err = op.Wait(ctx)
+		}
+		if err != nil && isFingerprintConflict(err) && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set instance labels: %w", err)
+		}
+		return nil
+	}
+}
+
+// SetMetadata merges items into the instance's metadata. If the metadata was changed concurrently,
+// e.g. by the VM's startup script, the update is retried once with the new fingerprint.
+func (p *gcpProvider) SetMetadata(ctx context.Context, inst InstanceConfig, items map[string]string) error {
+	return p.updateMetadata(ctx, inst, items, nil)
+}
+
+// RemoveMetadata deletes keys from the instance's metadata like SetMetadata merges items
+func (p *gcpProvider) RemoveMetadata(ctx context.Context, inst InstanceConfig, keys []string) error {
+	return p.updateMetadata(ctx, inst, nil, keys)
+}
+
+// updateMetadata merges items into the instance's metadata and deletes the keys in remove.
+// Nothing is written if none of the keys to remove is set and there are no items.
+func (p *gcpProvider) updateMetadata(ctx context.Context, inst InstanceConfig, items map[string]string, remove []string) error {
+	inst, err := p.resolveGroupMember(ctx, inst)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		instance, err := p.client.Get(ctx, &computepb.GetInstanceRequest{
+			Project:  inst.ProjectID,
+			Zone:     inst.Zone,
+			Instance: inst.InstanceName,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get instance metadata: %w", err)
+		}
+
+		metadata := instance.GetMetadata()
+		var merged []*computepb.Items
+		var removed bool
+		for _, item := range metadata.GetItems() {
+			if slices.Contains(remove, item.GetKey()) {
+				removed = true
+				continue
+			}
+			if _, ok := items[item.GetKey()]; !ok {
+				merged = append(merged, item)
+			}
+		}
+		if len(items) == 0 && !removed {
+			return nil
+		}
+		for _, key := range slices.Sorted(maps.Keys(items)) {
+			value := items[key]
+			merged = append(merged, &computepb.Items{
+				Key:   &key,
+				Value: &value,
+			})
+		}
+
+		op, err := p.client.SetMetadata(ctx, &computepb.SetMetadataInstanceRequest{
+			Project:  inst.ProjectID,
+			Zone:     inst.Zone,
+			Instance: inst.InstanceName,
+			MetadataResource: &computepb.Metadata{
+				Fingerprint: metadata.Fingerprint,
+				Items:       merged,
+			},
+		})
+		if err == nil {
+			err = op.Wait(ctx)
+		}
+		if err != nil && isFingerprintConflict(err) && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set instance metadata: %w", err)
+		}
+		return nil
+	}
+}
+
+// SerialPortOutput returns the recent output of serial port 1 of the instance
+func (p *gcpProvider) SerialPortOutput(ctx context.Context, inst InstanceConfig) (string, error) {
+	inst, err := p.resolveGroupMember(ctx, inst)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := p.client.GetSerialPortOutput(ctx, &computepb.GetSerialPortOutputInstanceRequest{
+		Project:  inst.ProjectID,
+		Zone:     inst.Zone,
+		Instance: inst.InstanceName,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get serial port output: %w", err)
+	}
+	return output.GetContents(), nil
+}
+
+// MissingPermissions tests the permissions on the instance with TestIamPermissions
+func (p *gcpProvider) MissingPermissions(ctx context.Context, inst InstanceConfig, permissions []string) ([]string, error) {
+	resp, err := p.client.TestIamPermissions(ctx, &computepb.TestIamPermissionsInstanceRequest{
+		Project:  inst.ProjectID,
+		Zone:     inst.Zone,
+		Resource: inst.InstanceName,
+		TestPermissionsRequestResource: &computepb.TestPermissionsRequest{
+			Permissions: permissions,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to test permissions: %w", err)
+	}
+
+	var missing []string
+	for _, permission := range permissions {
+		if !slices.Contains(resp.GetPermissions(), permission) {
+			missing = append(missing, permission)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,108 @@
+package gcpcontroller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// Supported values for readiness.source
+const (
+	readinessNetwork        = "network"
+	readinessGuestAttribute = "guestAttribute"
+	readinessMetadata       = "metadata"
+)
+
+// readinessSources are the supported values for readiness.source, matched case-insensitively
+var readinessSources = []string{readinessNetwork, readinessGuestAttribute, readinessMetadata}
+
+// canonicalReadinessSource returns the supported spelling of a readiness source, or source
+// itself if it isn't supported
+func canonicalReadinessSource(source string) string {
+	for _, supported := range readinessSources {
+		if strings.EqualFold(source, supported) {
+			return supported
+		}
+	}
+	return source
+}
+
+// ReadinessConfig configures how the controller decides that the server is ready for players
+type ReadinessConfig struct {
+	// Source is where the VM signals readiness: network, guestAttribute or metadata
+	Source string
+	// Key is the guest attribute (namespace/key) or metadata key the VM sets
+	Key string
+	// Value is the value of Key that marks the server as ready
+	Value string
+	// ProbeIntervalSeconds is how often the server is probed in the background, 0 to probe on every
+	// connection instead
+	ProbeIntervalSeconds int
+	// StartingProbeIntervalSeconds is how often the server is probed while its instance boots
+	StartingProbeIntervalSeconds int
+	// MaxAgeSeconds is how old a background probe result may be before a connection probes again
+	MaxAgeSeconds int
+}
+
+// isServerReady checks if the server is reachable and, if configured, whether the VM
+// reports itself as ready. If the VM has not set the readiness key at all, the network
+// probe alone decides. If the key can't be read, the server is not ready.
+func (g *gcpController) isServerReady(server proxy.RegisteredServer) bool {
+	if !g.isServerReachable(server) {
+		return false
+	}
+
+	readiness := g.config.Readiness
+	if readiness.Source == readinessNetwork {
+		return true
+	}
+
+	g.mu.RLock()
+	inst := g.config.instances()[g.activeInstance]
+	g.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	value, found, err := g.provider.ReadinessSignal(ctx, inst, readiness.Source, readiness.Key)
+	if err != nil {
+		g.log.Error(err, "Failed to read readiness signal, server is not ready",
+			"source", readiness.Source,
+			"key", readiness.Key)
+		return false
+	}
+	if !found {
+		g.log.V(1).Info("Readiness key is not set, falling back to network probe",
+			"source", readiness.Source,
+			"key", readiness.Key)
+		return true
+	}
+
+	ready := value == readiness.Value
+	if !ready {
+		g.log.V(1).Info("Server is reachable but VM does not report ready yet",
+			"source", readiness.Source,
+			"key", readiness.Key,
+			"value", value)
+	}
+	return ready
+}
+
+// resetReadinessSignal deletes the readiness metadata key before an instance is started, so a
+// value left over from the previous boot doesn't mark the new boot as ready, and a VM that never
+// sets the key is left to the network probe. Guest attributes
+// can only be written by the VM, and instances of a group are created from their template, so
+// neither is reset.
+func (g *gcpController) resetReadinessSignal(ctx context.Context, inst InstanceConfig) error {
+	readiness := g.config.Readiness
+	if readiness.Source != readinessMetadata || inst.InstanceGroup != "" {
+		return nil
+	}
+	if err := g.provider.RemoveMetadata(ctx, inst, []string{readiness.Key}); err != nil {
+		return fmt.Errorf("failed to reset readiness key %s: %w", readiness.Key, err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package gcpcontroller
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+
+	"github.com/minekube/gate-plugin-template/plugins/gcpcontroller/internal/fakecompute"
+)
+
+// listenServer points the managed server entry at a local listener, so the network probe succeeds
+func listenServer(t *testing.T, g *gcpController) proxy.RegisteredServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	if old := g.proxy.Server(testServer); old != nil {
+		g.proxy.Unregister(old.ServerInfo())
+	}
+	server, err := g.proxy.Register(proxy.NewServerInfo(testServer, ln.Addr()))
+	if err != nil {
+		t.Fatalf("failed to register server: %v", err)
+	}
+	return server
+}
+
+func TestResetReadinessSignal(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, func(c *Config) {
+		c.Readiness = ReadinessConfig{Source: readinessMetadata, Key: "minecraft-ready", Value: "true"}
+	})
+	ctx := context.Background()
+
+	// Left over from the previous boot
+	inst := g.config.instances()[0]
+	if err := g.provider.SetMetadata(ctx, inst, map[string]string{"minecraft-ready": "true"}); err != nil {
+		t.Fatalf("SetMetadata: %v", err)
+	}
+
+	if _, err := g.tryStartServer(ctx, trigger{Reason: "player_connect"}); err != nil {
+		t.Fatalf("tryStartServer: %v", err)
+	}
+	if value, ok := fake.Metadata(testProject, testZone, testInstance)["minecraft-ready"]; ok {
+		t.Errorf("readiness key after start = %q, want it deleted", value)
+	}
+
+	server := listenServer(t, g)
+	if err := g.provider.SetMetadata(ctx, inst, map[string]string{"minecraft-ready": "false"}); err != nil {
+		t.Fatalf("SetMetadata: %v", err)
+	}
+	if g.isServerReady(server) {
+		t.Error("isServerReady = true before the VM reported ready")
+	}
+	if err := g.provider.SetMetadata(ctx, inst, map[string]string{"minecraft-ready": "true"}); err != nil {
+		t.Fatalf("SetMetadata: %v", err)
+	}
+	if !g.isServerReady(server) {
+		t.Error("isServerReady = false after the VM set the readiness key")
+	}
+}
+
+func TestReadinessKeyNeverSet(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, func(c *Config) {
+		c.Readiness = ReadinessConfig{Source: readinessMetadata, Key: "minecraft-ready", Value: "true"}
+	})
+
+	if _, err := g.tryStartServer(context.Background(), trigger{Reason: "player_connect"}); err != nil {
+		t.Fatalf("tryStartServer: %v", err)
+	}
+	// Nothing to delete, so the metadata isn't written
+	if n := fake.Requests(fakecompute.ActionMetadata); n != 0 {
+		t.Errorf("metadata requests = %d, want 0", n)
+	}
+
+	// The VM doesn't set the key, the network probe alone decides
+	server := listenServer(t, g)
+	if !g.isServerReady(server) {
+		t.Error("isServerReady = false for a reachable server whose VM never sets the readiness key")
+	}
+}
+
+func TestReadinessSignalError(t *testing.T) {
+	g, fake := newTestController(t, statusRunning, func(c *Config) {
+		c.Readiness = ReadinessConfig{Source: readinessMetadata, Key: "minecraft-ready", Value: "true"}
+	})
+	server := listenServer(t, g)
+
+	fake.FailRequests(fakecompute.ActionGet, http.StatusForbidden, 1)
+	if g.isServerReady(server) {
+		t.Error("isServerReady = true although the readiness key couldn't be read")
+	}
+}
+
+func TestCanonicalReadinessSource(t *testing.T) {
+	for source, want := range map[string]string{
+		"network":        readinessNetwork,
+		"GuestAttribute": readinessGuestAttribute,
+		"guestattribute": readinessGuestAttribute,
+		"METADATA":       readinessMetadata,
+		"dns":            "dns",
+	} {
+		if got := canonicalReadinessSource(source); got != want {
+			t.Errorf("canonicalReadinessSource(%q) = %q, want %q", source, got, want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package gcpcontroller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultReportPeriod is the period summarized by /gcp report without an argument
+const defaultReportPeriod = 7 * 24 * time.Hour
+
+// maxReportPeriod is the longest period a report may cover
+const maxReportPeriod = 366 * 24 * time.Hour
+
+// ReportConfig configures the cost estimate of /gcp report
+type ReportConfig struct {
+	// HourlyPrice is what the instance costs per hour while running, e.g. 0.134
+	HourlyPrice float64
+	// Currency is shown next to prices, e.g. USD
+	Currency string
+}
+
+// serverReport summarizes the lifecycle of a managed server within the report period
+type serverReport struct {
+	Server        string  `json:"server"`
+	UptimeSeconds float64 `json:"uptimeSeconds"`
+	Starts        int     `json:"starts"`
+	// Sessions are the runs that a player joined, lasting from the first join until the stop
+	Sessions              int     `json:"sessions"`
+	AverageSessionSeconds float64 `json:"averageSessionSeconds"`
+	// IdleSeconds is the time the server ran without players while waiting for the idle
+	// timeout, or for the no-join safety timeout after nobody joined
+	IdleSeconds       float64 `json:"idleSeconds"`
+	EstimatedCost     float64 `json:"estimatedCost"`
+	AlwaysOnCost      float64 `json:"alwaysOnCost"`
+	EstimatedSavings  float64 `json:"estimatedSavings"`
+	SavingsPercentage float64 `json:"savingsPercentage"`
+}
+
+// costReport summarizes the lifecycle of all managed servers within a period
+type costReport struct {
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+	HourlyPrice float64        `json:"hourlyPrice"`
+	Currency    string         `json:"currency,omitempty"`
+	Servers     []serverReport `json:"servers"`
+	Total       serverReport   `json:"total"`
+}
+
+// parseReportPeriod parses a report period like 24h, 7d or 30d. An empty period is the default period.
+func parseReportPeriod(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultReportPeriod, nil
+	}
+
+	var period time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid period %q", s)
+		}
+		period = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		period, err = time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid period %q", s)
+		}
+	}
+
+	if period <= 0 || period > maxReportPeriod {
+		return 0, fmt.Errorf("period must be between 1s and %dd", int(maxReportPeriod.Hours()/24))
+	}
+	return period, nil
+}
+
+// report summarizes the audit log of all managed servers for the given period up to now
+func (g *gcpController) report(period time.Duration) (costReport, error) {
+	records, err := g.auditLog.all()
+	if err != nil {
+		return costReport{}, err
+	}
+
+	var servers []string
+	for _, server := range g.config.servers() {
+		servers = append(servers, server.ServerAddress)
+	}
+
+	to := time.Now()
+	return buildReport(records, servers, to.Add(-period), to, g.config.Report), nil
+}
+
+// buildReport summarizes the audit records of the given servers between from and to.
+// Records without a server belong to the first server, they were written before
+// multiple managed servers were supported.
+func buildReport(records []auditRecord, servers []string, from, to time.Time, config ReportConfig) costReport {
+	report := costReport{
+		From:        from,
+		To:          to,
+		HourlyPrice: config.HourlyPrice,
+		Currency:    config.Currency,
+		Total:       serverReport{Server: "total"},
+	}
+
+	for _, server := range servers {
+		r := buildServerReport(records, server, server == servers[0], from, to)
+		r.estimateCost(to.Sub(from), config.HourlyPrice)
+		report.Servers = append(report.Servers, r)
+
+		report.Total.UptimeSeconds += r.UptimeSeconds
+		report.Total.Starts += r.Starts
+		report.Total.Sessions += r.Sessions
+		report.Total.AverageSessionSeconds += r.AverageSessionSeconds * float64(r.Sessions)
+		report.Total.IdleSeconds += r.IdleSeconds
+	}
+	if report.Total.Sessions > 0 {
+		report.Total.AverageSessionSeconds /= float64(report.Total.Sessions)
+	}
+	report.Total.estimateCost(time.Duration(len(servers))*to.Sub(from), config.HourlyPrice)
+
+	return report
+}
+
+// buildServerReport replays the audit records of a server to measure its uptime and idle time
+func buildServerReport(records []auditRecord, server string, primary bool, from, to time.Time) serverReport {
+	r := serverReport{Server: server}
+
+	// overlap returns the part of the interval start..end within the report period
+	overlap := func(start, end time.Time) float64 {
+		start, end = maxTime(start, from), minTime(end, to)
+		if !end.After(start) {
+			return 0
+		}
+		return end.Sub(start).Seconds()
+	}
+
+	var (
+		runningSince time.Time
+		joinedSince  time.Time
+		idleSince    time.Time
+		sessionTotal float64
+	)
+	for _, rec := range records {
+		if rec.Server != server && (rec.Server != "" || !primary) {
+			continue
+		}
+		if rec.Time.After(to) {
+			break
+		}
+
+		switch rec.Event {
+		case auditStartSucceeded:
+			if runningSince.IsZero() {
+				runningSince = rec.Time
+			}
+			idleSince = time.Time{}
+			if !rec.Time.Before(from) {
+				r.Starts++
+			}
+
+		case auditFirstJoin:
+			if joinedSince.IsZero() {
+				joinedSince = rec.Time
+			}
+
+		case auditShutdownScheduled:
+			idleSince = rec.Time
+
+		case auditShutdownCancelled:
+			if !idleSince.IsZero() {
+				r.IdleSeconds += overlap(idleSince, rec.Time)
+				idleSince = time.Time{}
+			}
+
+		case auditStop, auditSafetyShutdown:
+			// The start may not be in the log, e.g. if it was rotated
+			if runningSince.IsZero() && rec.UptimeSeconds > 0 {
+				runningSince = rec.Time.Add(-time.Duration(rec.UptimeSeconds * float64(time.Second)))
+			}
+			if !runningSince.IsZero() {
+				r.UptimeSeconds += overlap(runningSince, rec.Time)
+			}
+			// Runs nobody joined are no sessions
+			if !joinedSince.IsZero() && !rec.Time.Before(from) {
+				r.Sessions++
+				sessionTotal += rec.Time.Sub(joinedSince).Seconds()
+			}
+
+			// Nobody joined after a safety shutdown, so the whole run was idle
+			switch {
+			case rec.Event == auditSafetyShutdown && !runningSince.IsZero():
+				r.IdleSeconds += overlap(runningSince, rec.Time)
+			case !idleSince.IsZero():
+				r.IdleSeconds += overlap(idleSince, rec.Time)
+			}
+			runningSince, joinedSince, idleSince = time.Time{}, time.Time{}, time.Time{}
+		}
+	}
+
+	// Still running at the end of the period
+	end := minTime(to, time.Now())
+	if !runningSince.IsZero() {
+		r.UptimeSeconds += overlap(runningSince, end)
+	}
+	if !idleSince.IsZero() {
+		r.IdleSeconds += overlap(idleSince, end)
+	}
+
+	if r.Sessions > 0 {
+		r.AverageSessionSeconds = sessionTotal / float64(r.Sessions)
+	}
+	return r
+}
+
+// estimateCost fills in the costs of the uptime and of running for the whole period
+func (r *serverReport) estimateCost(period time.Duration, hourlyPrice float64) {
+	r.EstimatedCost = r.UptimeSeconds / 3600 * hourlyPrice
+	r.AlwaysOnCost = period.Hours() * hourlyPrice
+	r.EstimatedSavings = r.AlwaysOnCost - r.EstimatedCost
+	if r.AlwaysOnCost > 0 {
+		r.SavingsPercentage = r.EstimatedSavings / r.AlwaysOnCost * 100
+	}
+}
+
+// formatPrice formats a price with the configured currency
+func (cfg ReportConfig) formatPrice(price float64) string {
+	if cfg.Currency == "" {
+		return fmt.Sprintf("%.2f", price)
+	}
+	return fmt.Sprintf("%.2f %s", price, cfg.Currency)
+}
+
+// formatHours formats a duration of possibly many hours, e.g. 12h 30m
+func formatHours(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Minute)
+	if d < time.Hour {
+		return formatDuration(d)
+	}
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+	if minutes == 0 {
+		return fmt.Sprintf("%dh", hours)
+	}
+	return fmt.Sprintf("%dh %dm", hours, minutes)
+}
+
+// formatPeriod formats a report period, in days if it is a whole number of days
+func formatPeriod(period time.Duration) string {
+	if period%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", int(period.Hours()/24))
+	}
+	return period.String()
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
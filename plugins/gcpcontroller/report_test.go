@@ -0,0 +1,82 @@
+package gcpcontroller
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBuildReport(t *testing.T) {
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	at := func(hours float64) time.Time {
+		return from.Add(time.Duration(hours * float64(time.Hour)))
+	}
+
+	records := []auditRecord{
+		// Started before the period, counted from its beginning
+		{Time: at(-1), Event: auditStartSucceeded, Server: "server1"},
+		{Time: at(-0.5), Event: auditFirstJoin, Server: "server1"},
+		{Time: at(1), Event: auditShutdownScheduled, Server: "server1"},
+		{Time: at(1.5), Event: auditStop, Server: "server1", UptimeSeconds: 2.5 * 3600},
+		// Written before multiple servers were supported, belongs to the first server
+		{Time: at(4), Event: auditStartSucceeded},
+		{Time: at(4.25), Event: auditSafetyShutdown},
+		{Time: at(10), Event: auditStartSucceeded, Server: "server2"},
+		{Time: at(10.25), Event: auditFirstJoin, Server: "server2"},
+		{Time: at(11), Event: auditShutdownScheduled, Server: "server2"},
+		{Time: at(11.5), Event: auditShutdownCancelled, Server: "server2"},
+		{Time: at(12), Event: auditShutdownScheduled, Server: "server2"},
+		{Time: at(13), Event: auditStop, Server: "server2"},
+		// After the period
+		{Time: at(30), Event: auditStartSucceeded, Server: "server2"},
+	}
+
+	report := buildReport(records, []string{"server1", "server2"}, from, to, ReportConfig{HourlyPrice: 0.5})
+
+	tests := []struct {
+		name     string
+		got      float64
+		expected float64
+	}{
+		{"server1 uptime", report.Servers[0].UptimeSeconds, 1.75 * 3600},
+		{"server1 starts", float64(report.Servers[0].Starts), 1},
+		// The run stopped by the safety shutdown had no players and is no session
+		{"server1 sessions", float64(report.Servers[0].Sessions), 1},
+		{"server1 average session", report.Servers[0].AverageSessionSeconds, 2 * 3600},
+		{"server1 idle", report.Servers[0].IdleSeconds, 0.75 * 3600},
+		{"server2 uptime", report.Servers[1].UptimeSeconds, 3 * 3600},
+		{"server2 idle", report.Servers[1].IdleSeconds, 1.5 * 3600},
+		{"server2 average session", report.Servers[1].AverageSessionSeconds, 2.75 * 3600},
+		{"total average session", report.Total.AverageSessionSeconds, (2 + 2.75) / 2 * 3600},
+		{"server2 cost", report.Servers[1].EstimatedCost, 1.5},
+		{"server2 always-on cost", report.Servers[1].AlwaysOnCost, 12},
+		{"total starts", float64(report.Total.Starts), 2},
+		{"total savings", report.Total.EstimatedSavings, 24 - 4.75*0.5},
+	}
+	for _, tt := range tests {
+		if math.Abs(tt.got-tt.expected) > 1e-6 {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.expected)
+		}
+	}
+}
+
+func TestParseReportPeriod(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":    defaultReportPeriod,
+		"30d": 30 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+	}
+	for in, expected := range tests {
+		got, err := parseReportPeriod(in)
+		if err != nil || got != expected {
+			t.Errorf("parseReportPeriod(%q) = %v, %v, want %v", in, got, err, expected)
+		}
+	}
+
+	for _, in := range []string{"0d", "-1h", "week", "400d"} {
+		if _, err := parseReportPeriod(in); err == nil {
+			t.Errorf("parseReportPeriod(%q) succeeded, want error", in)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package gcpcontroller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// serverAddr is a net.Addr for backend addresses given as host:port strings
+type serverAddr string
+
+func (a serverAddr) Network() string { return "tcp" }
+func (a serverAddr) String() string  { return string(a) }
+
+// routeToStartedInstance looks up a freshly started instance and points the managed server entry at it.
+// Must be called with g.mu held.
+func (g *gcpController) routeToStartedInstance(ctx context.Context, index int) error {
+	var info *instanceInfo
+	if g.config.AddressSource != "" {
+		var err error
+		info, err = g.provider.Get(ctx, g.config.instances()[index])
+		if err != nil {
+			return fmt.Errorf("failed to get instance addresses: %w", err)
+		}
+	}
+	return g.routeToInstance(index, info)
+}
+
+// retryPendingRoute points the server entry at the active instance if that failed right after
+// the start, e.g. because an instance group had not created its instance yet
+func (g *gcpController) retryPendingRoute() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.routePending {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := g.routeToStartedInstance(ctx, g.activeInstance); err != nil {
+		g.log.V(1).Info("Started instance has no address yet", "error", err.Error())
+		return
+	}
+	g.routePending = false
+}
+
+// routeToInstance points the managed server entry at the instance with the given index.
+// The entry keeps its name so that connections to serverAddress are still matched.
+// info is only needed when the address is resolved from the instance's IP.
+// Must be called with g.mu held.
+func (g *gcpController) routeToInstance(index int, info *instanceInfo) error {
+	current := g.proxy.Server(g.config.ServerAddress)
+	if current == nil {
+		return fmt.Errorf("server %q is not registered in the proxy", g.config.ServerAddress)
+	}
+
+	// Remember the configured address before it is replaced for the first time
+	if g.primaryAddress == "" {
+		g.primaryAddress = current.ServerInfo().Addr().String()
+	}
+
+	addr := g.config.instances()[index].Address
+	if addr == "" {
+		addr = g.primaryAddress
+	}
+
+	// Replace the host by the instance's current IP, keeping the port
+	if g.config.AddressSource != "" && info != nil {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("invalid server address %q: %w", addr, err)
+		}
+		ip, err := info.ip(g.config.AddressSource)
+		if err != nil {
+			return err
+		}
+		addr = net.JoinHostPort(ip, port)
+	}
+
+	return g.setServerAddress(current, addr)
+}
+
+// setServerAddress re-registers the managed server entry with a new backend address
+func (g *gcpController) setServerAddress(current proxy.RegisteredServer, addr string) error {
+	previous := current.ServerInfo().Addr().String()
+	if previous == addr {
+		return nil
+	}
+
+	g.proxy.Unregister(current.ServerInfo())
+	if _, err := g.proxy.Register(proxy.NewServerInfo(g.config.ServerAddress, serverAddr(addr))); err != nil {
+		// Restore the previous entry so the server does not disappear from the proxy
+		if _, restoreErr := g.proxy.Register(current.ServerInfo()); restoreErr != nil {
+			g.log.Error(restoreErr, "Failed to restore server entry",
+				"server", g.config.ServerAddress,
+				"address", previous)
+		}
+		return fmt.Errorf("failed to register server %q with address %s: %w", g.config.ServerAddress, addr, err)
+	}
+
+	g.log.Info("Updated server address",
+		"server", g.config.ServerAddress,
+		"from", previous,
+		"to", addr)
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package gcpcontroller
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// SimulatedConfig holds the settings of the simulated provider
+type SimulatedConfig struct {
+	BootDelaySeconds     int
+	ShutdownDelaySeconds int
+	StartFailureRate     float64
+	StopFailureRate      float64
+	InitialStatus        string
+	ExhaustedZones       []string
+}
+
+// simulatedProvider drives in-process fake instances instead of calling GCP.
+// It is meant for testing the controller locally against a Minecraft server
+// that is always running: the server only counts as reachable while a fake instance is RUNNING.
+type simulatedProvider struct {
+	config *Config
+	log    logr.Logger
+
+	mu         sync.Mutex
+	statuses   map[string]string // instance key -> status
+	operations map[string]*simulatedOperation
+	nextOpID   int
+}
+
+// simulatedOperation is a fake zone operation, done is closed when it completes
+type simulatedOperation struct {
+	done chan struct{}
+	err  error
+}
+
+// newSimulatedProvider creates a simulated provider whose primary instance is in its configured initial state
+func newSimulatedProvider(config *Config, log logr.Logger) *simulatedProvider {
+	p := &simulatedProvider{
+		config:     config,
+		log:        log.WithName("simulated"),
+		statuses:   make(map[string]string),
+		operations: make(map[string]*simulatedOperation),
+	}
+	for _, server := range config.servers() {
+		p.statuses[server.primaryInstance().key()] = config.Simulated.InitialStatus
+	}
+	return p
+}
+
+// Get returns the state of a fake instance. Its IPs always point at the local machine.
+func (p *simulatedProvider) Get(_ context.Context, inst InstanceConfig) (*instanceInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info := &instanceInfo{Status: p.statusLocked(inst)}
+	if info.Status == statusRunning {
+		info.InternalIP = "127.0.0.1"
+		info.ExternalIP = "127.0.0.1"
+	}
+	return info, nil
+}
+
+// statusLocked returns the status of a fake instance, which is TERMINATED until it is first started
+func (p *simulatedProvider) statusLocked(inst InstanceConfig) string {
+	status, ok := p.statuses[inst.key()]
+	if !ok {
+		return statusTerminated
+	}
+	return status
+}
+
+// isRunning reports whether any of the given fake instances is currently running
+func (p *simulatedProvider) isRunning(instances []InstanceConfig) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, inst := range instances {
+		if p.statusLocked(inst) == statusRunning {
+			return true
+		}
+	}
+	return false
+}
+
+// Start simulates a start operation that completes after the boot delay
+func (p *simulatedProvider) Start(_ context.Context, inst InstanceConfig) (string, error) {
+	p.log.Info("Would start GCP instance",
+		"project", inst.ProjectID,
+		"zone", inst.Zone,
+		"instance", inst.name())
+
+	if rand.Float64() < p.config.Simulated.StartFailureRate {
+		return "", fmt.Errorf("failed to start instance: simulated failure")
+	}
+
+	var opErr error
+	if slices.Contains(p.config.Simulated.ExhaustedZones, inst.Zone) {
+		opErr = &operationFailedError{msg: fmt.Sprintf("ZONE_RESOURCE_POOL_EXHAUSTED: "+
+			"the zone '%s' does not have enough resources available to fulfill the request (simulated)", inst.Zone)}
+	}
+
+	delay := time.Duration(p.config.Simulated.BootDelaySeconds) * time.Second
+	return p.transition(inst, statusStaging, statusRunning, delay, opErr), nil
+}
+
+// Stop simulates a stop operation that completes after the shutdown delay
+func (p *simulatedProvider) Stop(_ context.Context, inst InstanceConfig) (string, error) {
+	p.log.Info("Would stop GCP instance",
+		"project", inst.ProjectID,
+		"zone", inst.Zone,
+		"instance", inst.name())
+
+	if rand.Float64() < p.config.Simulated.StopFailureRate {
+		return "", fmt.Errorf("failed to stop instance: simulated failure")
+	}
+
+	delay := time.Duration(p.config.Simulated.ShutdownDelaySeconds) * time.Second
+	return p.transition(inst, statusStopping, statusTerminated, delay, nil), nil
+}
+
+// Reset simulates a reset, which keeps the instance RUNNING
+func (p *simulatedProvider) Reset(_ context.Context, inst InstanceConfig) (string, error) {
+	p.log.Info("Would reset GCP instance",
+		"project", inst.ProjectID,
+		"zone", inst.Zone,
+		"instance", inst.name())
+
+	return p.transition(inst, statusRunning, statusRunning, 0, nil), nil
+}
+
+// WaitOperation waits for a fake operation to complete. Operations started before a
+// restart of the proxy are unknown and reported as done.
+func (p *simulatedProvider) WaitOperation(ctx context.Context, _ InstanceConfig, operation string) error {
+	p.mu.Lock()
+	op, ok := p.operations[operation]
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	select {
+	case <-op.done:
+		return op.err
+	case <-ctx.Done():
+		return fmt.Errorf("failed to wait for operation %s: %w", operation, ctx.Err())
+	}
+}
+
+// ReadinessSignal reports the readiness key as not set, so the network probe alone decides
+func (p *simulatedProvider) ReadinessSignal(_ context.Context, inst InstanceConfig, source, key string) (string, bool, error) {
+	p.log.V(1).Info("Would read readiness signal",
+		"instance", inst.name(),
+		"source", source,
+		"key", key)
+	return "", false, nil
+}
+
+// SetLabels logs the labels that would be written
+func (p *simulatedProvider) SetLabels(_ context.Context, inst InstanceConfig, labels map[string]string) error {
+	p.log.V(1).Info("Would set instance labels",
+		"instance", inst.name(),
+		"labels", labels)
+	return nil
+}
+
+// SetMetadata logs the metadata items that would be written
+func (p *simulatedProvider) SetMetadata(_ context.Context, inst InstanceConfig, items map[string]string) error {
+	p.log.V(1).Info("Would set instance metadata",
+		"instance", inst.name(),
+		"items", items)
+	return nil
+}
+
+// RemoveMetadata logs the metadata keys that would be deleted
+func (p *simulatedProvider) RemoveMetadata(_ context.Context, inst InstanceConfig, keys []string) error {
+	p.log.V(1).Info("Would remove instance metadata",
+		"instance", inst.name(),
+		"keys", keys)
+	return nil
+}
+
+// SerialPortOutput returns a fake boot log of the instance's current status
+func (p *simulatedProvider) SerialPortOutput(_ context.Context, inst InstanceConfig) (string, error) {
+	p.mu.Lock()
+	status := p.statusLocked(inst)
+	p.mu.Unlock()
+
+	if status != statusRunning {
+		return "", nil
+	}
+	return fmt.Sprintf("Simulated instance %s booted\nGoogle startup-script: Starting Minecraft server\n", inst.name()), nil
+}
+
+// MissingPermissions reports all permissions as granted
+func (p *simulatedProvider) MissingPermissions(context.Context, InstanceConfig, []string) ([]string, error) {
+	return nil, nil
+}
+
+// transition starts a fake operation that moves an instance through an intermediate status into
+// its final status and returns the operation name. If opErr is set, the operation fails after the
+// delay instead and the instance goes back to TERMINATED, like a start that GCE gave up on.
+func (p *simulatedProvider) transition(inst InstanceConfig, intermediate, final string, delay time.Duration, opErr error) string {
+	p.mu.Lock()
+	p.nextOpID++
+	name := fmt.Sprintf("simulated-operation-%d", p.nextOpID)
+	op := &simulatedOperation{done: make(chan struct{})}
+	p.operations[name] = op
+	p.mu.Unlock()
+
+	p.setStatus(inst, intermediate)
+	time.AfterFunc(delay, func() {
+		if opErr != nil {
+			p.setStatus(inst, statusTerminated)
+		} else {
+			p.setStatus(inst, final)
+		}
+		op.err = opErr
+		close(op.done)
+	})
+
+	return name
+}
+
+// setStatus updates the status of a fake instance
+func (p *simulatedProvider) setStatus(inst InstanceConfig, status string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if previous := p.statusLocked(inst); previous != status {
+		p.log.Info("Simulated instance status changed",
+			"instance", inst.name(),
+			"from", previous,
+			"to", status)
+	}
+	p.statuses[inst.key()] = status
+}
@@ -0,0 +1,134 @@
+package gcpcontroller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// StartProfileConfig configures instance metadata set before a start, so the VM's startup script
+// can decide e.g. which world or Minecraft version to run
+type StartProfileConfig struct {
+	Name string `mapstructure:"name"`
+	// Metadata are the items set on the instance as key=value
+	Metadata []string `mapstructure:"metadata"`
+	// VirtualHosts select this profile when a player connects with one of them
+	VirtualHosts []string `mapstructure:"virtualHosts"`
+
+	items map[string]string // parsed from Metadata
+}
+
+// validateStartProfiles checks the start profiles and parses their metadata
+func validateStartProfiles(profiles []StartProfileConfig) error {
+	names := make(map[string]bool)
+	for i := range profiles {
+		profile := &profiles[i]
+		key := fmt.Sprintf("gcpController.startProfiles[%d]", i)
+
+		if profile.Name == "" {
+			return fmt.Errorf("%s.name is required", key)
+		}
+		if names[profile.Name] {
+			return fmt.Errorf("%s.name %q is used more than once", key, profile.Name)
+		}
+		names[profile.Name] = true
+
+		profile.items = make(map[string]string, len(profile.Metadata))
+		for _, item := range profile.Metadata {
+			k, v, ok := strings.Cut(item, "=")
+			if !ok || strings.TrimSpace(k) == "" {
+				return fmt.Errorf("%s.metadata item %q must be key=value", key, item)
+			}
+			profile.items[strings.TrimSpace(k)] = v
+		}
+		for j, host := range profile.VirtualHosts {
+			profile.VirtualHosts[j] = normalizeHost(host)
+		}
+	}
+	return nil
+}
+
+// validateGroupProfiles checks that no start profile can be selected for a server whose instances
+// include an instance group, by its startProfile or by a virtual host that reaches it. Instances of
+// a group are created from their template, so applyStartProfile would fail every start.
+func validateGroupProfiles(servers []*Config, profiles []StartProfileConfig) error {
+	for _, server := range servers {
+		i := slices.IndexFunc(server.instances(), func(inst InstanceConfig) bool { return inst.InstanceGroup != "" })
+		if i < 0 {
+			continue
+		}
+		group := server.instances()[i].InstanceGroup
+
+		if server.StartProfile != "" {
+			return fmt.Errorf("start profile %q of server %s can't be applied to instance group %s, "+
+				"set the metadata in its instance template instead", server.StartProfile, server.ServerAddress, group)
+		}
+		for _, profile := range profiles {
+			for _, host := range profile.VirtualHosts {
+				if acceptsHost(servers, server, host) {
+					return fmt.Errorf("start profile %q of virtual host %s can't be applied to instance group %s "+
+						"of server %s, set the metadata in its instance template instead",
+						profile.Name, host, group, server.ServerAddress)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// startProfile returns the profile with the given name, or the default profile of the managed
+// server if name is empty. It returns nil if neither is set.
+func (g *gcpController) startProfile(name string) (*StartProfileConfig, error) {
+	if name == "" {
+		name = g.config.StartProfile
+	}
+	if name == "" {
+		return nil, nil
+	}
+	for i := range g.config.StartProfiles {
+		if g.config.StartProfiles[i].Name == name {
+			return &g.config.StartProfiles[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown start profile %q", name)
+}
+
+// virtualHostProfile returns the name of the start profile selected by the virtual host a
+// player connected with, or an empty string if none is
+func (g *gcpController) virtualHostProfile(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host := normalizeHost(addr.String())
+	for _, profile := range g.config.StartProfiles {
+		if slices.Contains(profile.VirtualHosts, host) {
+			return profile.Name
+		}
+	}
+	return ""
+}
+
+// applyStartProfile writes the metadata of a start profile to an instance before it is started
+func (g *gcpController) applyStartProfile(ctx context.Context, inst InstanceConfig, profile *StartProfileConfig) error {
+	if profile == nil {
+		return nil
+	}
+	if inst.InstanceGroup != "" {
+		return fmt.Errorf("start profile %q can't be applied to instance group %s, "+
+			"set the metadata in its instance template instead", profile.Name, inst.InstanceGroup)
+	}
+	if len(profile.items) == 0 {
+		return nil
+	}
+
+	if err := g.provider.SetMetadata(ctx, inst, profile.items); err != nil {
+		return fmt.Errorf("failed to apply start profile %q: %w", profile.Name, err)
+	}
+	g.log.Info("Applied start profile",
+		"profile", profile.Name,
+		"instance", inst.name(),
+		"metadata", profile.items)
+	return nil
+}
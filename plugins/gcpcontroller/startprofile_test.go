@@ -0,0 +1,96 @@
+package gcpcontroller
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	"github.com/minekube/gate-plugin-template/plugins/gcpcontroller/internal/fakecompute"
+)
+
+func TestStartProfile(t *testing.T) {
+	profiles := []StartProfileConfig{
+		{Name: "survival", Metadata: []string{"world=survival", "version=1.20.4"}},
+		{Name: "creative", Metadata: []string{"world=creative", "version=1.21"}, VirtualHosts: []string{"creative.example.com"}},
+	}
+	if err := validateStartProfiles(profiles); err != nil {
+		t.Fatalf("validateStartProfiles: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		profile  string
+		expected map[string]string
+	}{
+		{"default profile", "", map[string]string{"world": "survival", "version": "1.20.4"}},
+		{"requested profile", "creative", map[string]string{"world": "creative", "version": "1.21"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, fake := newTestController(t, statusTerminated, func(c *Config) {
+				c.StartProfiles = profiles
+				c.StartProfile = "survival"
+			})
+
+			outcome, err := g.tryStartServer(context.Background(), trigger{Reason: "operator_start", Profile: tt.profile})
+			if err != nil || outcome != startRequested {
+				t.Fatalf("tryStartServer = %v, %v, want %v", outcome, err, startRequested)
+			}
+			if got := fake.Metadata(testProject, testZone, testInstance); !maps.Equal(got, tt.expected) {
+				t.Errorf("metadata = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	t.Run("unknown profile", func(t *testing.T) {
+		g, fake := newTestController(t, statusTerminated, func(c *Config) {
+			c.StartProfiles = profiles
+		})
+		if outcome, err := g.tryStartServer(context.Background(), trigger{Profile: "hardcore"}); err == nil || outcome != startFailed {
+			t.Errorf("tryStartServer = %v, %v, want %v with error", outcome, err, startFailed)
+		}
+		if n := fake.Requests(fakecompute.ActionStart); n != 0 {
+			t.Errorf("start requests = %d, want 0", n)
+		}
+	})
+}
+
+func TestStartProfileValidation(t *testing.T) {
+	invalid := [][]StartProfileConfig{
+		{{Metadata: []string{"world=creative"}}},
+		{{Name: "creative", Metadata: []string{"world"}}},
+		{{Name: "creative"}, {Name: "creative"}},
+	}
+	for _, profiles := range invalid {
+		if err := validateStartProfiles(profiles); err == nil {
+			t.Errorf("validateStartProfiles(%+v) succeeded, want error", profiles)
+		}
+	}
+}
+
+func TestGroupProfileValidation(t *testing.T) {
+	group := &Config{ServerAddress: "server1", Zone: testZone, InstanceGroup: "minecraft-group"}
+	named := &Config{ServerAddress: "server2", Zone: testZone, InstanceName: testInstance, VirtualHosts: []string{"creative.example.com"}}
+	creative := StartProfileConfig{Name: "creative", VirtualHosts: []string{"creative.example.com"}}
+
+	// The virtual host only reaches the server with a named instance
+	if err := validateGroupProfiles([]*Config{group, named}, []StartProfileConfig{creative}); err != nil {
+		t.Errorf("validateGroupProfiles = %v, want nil", err)
+	}
+
+	withProfile := *group
+	withProfile.StartProfile = "creative"
+	hosted := *group
+	hosted.VirtualHosts = []string{"creative.example.com"}
+	invalid := [][]*Config{
+		{&withProfile, named},
+		// Without virtual hosts of its own, the group server gets every host no other server lists
+		{group},
+		{&hosted},
+	}
+	for _, servers := range invalid {
+		if err := validateGroupProfiles(servers, []StartProfileConfig{creative}); err == nil {
+			t.Errorf("validateGroupProfiles(%s) succeeded, want error", servers[0].ServerAddress)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package gcpcontroller
+
+import (
+	"net"
+	"slices"
+	"strings"
+
+	"go.minekube.com/gate/pkg/edition/java/proxy"
+)
+
+// normalizeHost lowercases a virtual host and strips the port and trailing dot
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// matchesVirtualHost checks if the virtual host a client connected with belongs to this managed server
+func (g *gcpController) matchesVirtualHost(addr net.Addr) bool {
+	if addr == nil {
+		return false
+	}
+	return slices.Contains(g.config.VirtualHosts, normalizeHost(addr.String()))
+}
+
+// acceptsVirtualHost checks if a connection with the given virtual host may trigger this managed
+// server. Servers with virtual hosts accept only those, servers without accept every host that
+// no other managed server lists.
+func (g *gcpController) acceptsVirtualHost(addr net.Addr) bool {
+	if len(g.config.VirtualHosts) > 0 {
+		return g.matchesVirtualHost(addr)
+	}
+	for _, other := range g.servers {
+		if other != g && other.matchesVirtualHost(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// acceptsHost is acceptsVirtualHost for a normalized host on the configuration of all managed servers
+func acceptsHost(servers []*Config, server *Config, host string) bool {
+	if len(server.VirtualHosts) > 0 {
+		return slices.Contains(server.VirtualHosts, host)
+	}
+	return !slices.ContainsFunc(servers, func(other *Config) bool {
+		return other != server && slices.Contains(other.VirtualHosts, host)
+	})
+}
+
+// onChooseInitialServer sends players that connect with one of the server's virtual hosts to it.
+// Runs after Gate has applied its forced hosts, so both can be used side by side.
+func (g *gcpController) onChooseInitialServer(e *proxy.PlayerChooseInitialServerEvent) {
+	if !g.matchesVirtualHost(e.Player().VirtualHost()) {
+		return
+	}
+
+	server := g.proxy.Server(g.config.ServerAddress)
+	if server == nil {
+		g.log.Info("Managed server is not registered, can't route virtual host",
+			"virtualHost", e.Player().VirtualHost())
+		return
+	}
+
+	e.SetInitialServer(server)
+}
+
+// onVirtualHostPing shows the server's MOTD to clients pinging one of its virtual hosts
+func (g *gcpController) onVirtualHostPing(e *proxy.PingEvent) {
+	if g.config.Motd == "" || !g.matchesVirtualHost(e.Connection().VirtualHost()) {
+		return
+	}
+
+	if ping := e.Ping(); ping != nil {
+		ping.Description = g.formatMessage(g.config.Motd, "")
+	}
+}
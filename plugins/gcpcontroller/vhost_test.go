@@ -0,0 +1,26 @@
+package gcpcontroller
+
+import "testing"
+
+func TestAcceptsVirtualHost(t *testing.T) {
+	survival := &gcpController{config: &Config{ServerAddress: "survival"}}
+	creative := &gcpController{config: &Config{ServerAddress: "creative", VirtualHosts: []string{"creative.example.com"}}}
+	servers := []*gcpController{survival, creative}
+	survival.servers, creative.servers = servers, servers
+
+	tests := []struct {
+		server *gcpController
+		host   string
+		want   bool
+	}{
+		{survival, "play.example.com:25565", true},
+		{survival, "Creative.Example.com:25565", false},
+		{creative, "creative.example.com:25565", true},
+		{creative, "play.example.com:25565", false},
+	}
+	for _, tt := range tests {
+		if got := tt.server.acceptsVirtualHost(serverAddr(tt.host)); got != tt.want {
+			t.Errorf("%s accepts %s = %v, want %v", tt.server.config.ServerAddress, tt.host, got, tt.want)
+		}
+	}
+}
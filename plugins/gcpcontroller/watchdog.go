@@ -0,0 +1,182 @@
+package gcpcontroller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+)
+
+// Supported values for watchdog.action
+const (
+	watchdogReset   = "reset"
+	watchdogRestart = "restart"
+)
+
+// watchdogOperationTimeout is how long the watchdog waits for each reset, stop or start operation
+const watchdogOperationTimeout = 3 * time.Minute
+
+// WatchdogConfig configures the recovery of instances that run but never become ready
+type WatchdogConfig struct {
+	Enabled bool
+	// TimeoutMinutes is how long a boot may take before the instance counts as hung. It must be
+	// shorter than bootWatchTimeout, after which a boot isn't watched anymore.
+	TimeoutMinutes int
+	// Action is how a hung instance is recovered: reset (Compute Engine reset) or restart (stop and start)
+	Action string
+	// MaxAttempts is how often a boot is recovered before the watchdog gives up
+	MaxAttempts int
+}
+
+// watchdog recovers the instance if the boot that started at startedAt didn't make the server
+// ready within watchdog.timeoutMinutes although the instance is RUNNING. It returns the start of
+// the boot to watch from now on, which is startedAt unless the instance was recovered.
+// Called by watchBoot while the server is not ready.
+func (g *gcpController) watchdog(startedAt time.Time) time.Time {
+	config := g.config.Watchdog
+	if !config.Enabled || time.Since(startedAt) < time.Duration(config.TimeoutMinutes)*time.Minute {
+		return startedAt
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*watchdogOperationTimeout)
+	defer cancel()
+
+	// Ignore stale watchers, e.g. when the server was stopped meanwhile
+	stale := func() bool {
+		return !g.isStarting || !g.bootStartedAt.Equal(startedAt) || g.watchdogGaveUp || g.transitioning
+	}
+	g.mu.RLock()
+	if stale() {
+		g.mu.RUnlock()
+		return startedAt
+	}
+	inst := g.config.instances()[g.activeInstance]
+	g.mu.RUnlock()
+	tr := trigger{Reason: "hung_instance"}
+
+	// The instance may still be booting at the GCE level, e.g. STAGING
+	status := g.currentStatus(ctx, inst)
+	if status != statusRunning {
+		return startedAt
+	}
+
+	g.mu.Lock()
+	if stale() || g.config.instances()[g.activeInstance] != inst {
+		g.mu.Unlock()
+		return startedAt
+	}
+
+	if g.watchdogAttempts >= config.MaxAttempts {
+		g.watchdogGaveUp = true
+		g.log.Info("Server did not become ready and can't be recovered, giving up",
+			"instance", inst.name(),
+			"attempts", g.watchdogAttempts)
+		g.audit(auditWatchdogFailed, tr, auditRecord{
+			Instance:     inst.name(),
+			Zone:         inst.Zone,
+			StatusBefore: status,
+			Error:        fmt.Sprintf("not ready after %d recovery attempts", g.watchdogAttempts),
+		})
+		g.mu.Unlock()
+		return startedAt
+	}
+
+	// Restart the boot, so waiting players get a new ETA and the no-join timer a new deadline
+	g.watchdogAttempts++
+	attempt := g.watchdogAttempts
+	recoveryStartedAt := time.Now()
+	g.bootStartedAt = recoveryStartedAt
+	waiting := maps.Clone(g.waitingPlayers)
+	g.mu.Unlock()
+
+	g.log.Info("Server did not become ready, recovering hung instance",
+		"instance", inst.name(),
+		"action", config.Action,
+		"attempt", attempt,
+		"maxAttempts", config.MaxAttempts,
+		"bootingFor", time.Since(startedAt).Round(time.Second))
+	g.notifyWaitingPlayers(waiting)
+	g.captureConsole("hung_instance")
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.isStarting || !g.bootStartedAt.Equal(recoveryStartedAt) || g.transitioning {
+		return recoveryStartedAt
+	}
+
+	// The recovery takes minutes, g.transitioning keeps starts and stops out meanwhile
+	var err error
+	var statusAfter string
+	g.withoutLock(func() {
+		err = g.recoverInstance(ctx, inst, config.Action)
+		statusAfter = g.currentStatus(ctx, inst)
+	})
+	rec := auditRecord{
+		Instance:        inst.name(),
+		Zone:            inst.Zone,
+		StatusBefore:    status,
+		StatusAfter:     statusAfter,
+		DurationSeconds: time.Since(recoveryStartedAt).Seconds(),
+	}
+	g.lastStatus = rec.StatusAfter
+	if err != nil {
+		rec.Error = err.Error()
+		g.audit(auditWatchdogFailed, tr, rec)
+		g.log.Error(err, "Failed to recover hung instance", "instance", inst.name())
+	} else {
+		g.audit(auditWatchdogRecovered, tr, rec)
+	}
+	// The server may have become ready while the instance was recovered
+	if !g.isStarting || !g.bootStartedAt.Equal(recoveryStartedAt) {
+		return recoveryStartedAt
+	}
+
+	// A restarted instance may have a new IP
+	if config.Action == watchdogRestart {
+		if g.config.AddressSource != "" {
+			if err := g.routeToStartedInstance(ctx, g.activeInstance); err != nil {
+				g.routePending = true
+			}
+		}
+		g.publishDNS(inst)
+	}
+
+	g.scheduleNoJoinSafetyShutdown()
+	return recoveryStartedAt
+}
+
+// recoverInstance resets or restarts a hung instance and waits for it
+func (g *gcpController) recoverInstance(ctx context.Context, inst InstanceConfig, action string) error {
+	run := func(fn func(context.Context, InstanceConfig) (string, error)) error {
+		opCtx, cancel := context.WithTimeout(ctx, watchdogOperationTimeout)
+		defer cancel()
+
+		operation, err := fn(opCtx, inst)
+		if err != nil {
+			return err
+		}
+		return g.provider.WaitOperation(opCtx, inst, operation)
+	}
+
+	if action == watchdogReset {
+		return run(g.provider.Reset)
+	}
+	if err := run(g.provider.Stop); err != nil {
+		return fmt.Errorf("failed to stop hung instance: %w", err)
+	}
+	return run(g.provider.Start)
+}
+
+// notifyWaitingPlayers tells players who tried to join during the boot and are still on the
+// proxy, e.g. on a lobby server, that the instance is being recovered
+func (g *gcpController) notifyWaitingPlayers(waiting map[string]string) {
+	for _, name := range waiting {
+		player := g.proxy.PlayerByName(name)
+		if player == nil {
+			continue
+		}
+		if err := player.SendMessage(g.formatMessage(g.config.Messages.Recovering, name)); err != nil {
+			g.log.V(1).Info("Failed to notify waiting player", "player", name, "error", err.Error())
+		}
+	}
+}
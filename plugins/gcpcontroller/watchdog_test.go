@@ -0,0 +1,128 @@
+package gcpcontroller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/minekube/gate-plugin-template/plugins/gcpcontroller/internal/fakecompute"
+)
+
+// startHungInstance starts the instance of a test controller and pretends its boot has been
+// going on for an hour. It returns the start time of the boot.
+func startHungInstance(t *testing.T, g *gcpController) time.Time {
+	t.Helper()
+
+	if _, err := g.tryStartServer(context.Background(), trigger{Reason: "player_connect"}); err != nil {
+		t.Fatalf("tryStartServer: %v", err)
+	}
+	return hangBoot(g)
+}
+
+// hangBoot pretends the current boot has been going on for an hour and returns its start time
+func hangBoot(g *gcpController) time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.bootStartedAt = time.Now().Add(-time.Hour)
+	return g.bootStartedAt
+}
+
+func TestWatchdogReset(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, func(c *Config) {
+		c.Watchdog = WatchdogConfig{Enabled: true, TimeoutMinutes: 5, Action: watchdogReset, MaxAttempts: 1}
+	})
+
+	startedAt := startHungInstance(t, g)
+	if recovered := g.watchdog(startedAt); recovered.Equal(startedAt) {
+		t.Fatalf("watchdog did not recover the hung instance")
+	}
+	if n := fake.Requests(fakecompute.ActionReset); n != 1 {
+		t.Errorf("reset requests = %d, want 1", n)
+	}
+	if events := auditEvents(t, g); events[len(events)-1] != auditWatchdogRecovered {
+		t.Errorf("audit events = %v, want %s last", events, auditWatchdogRecovered)
+	}
+
+	// The recovered boot hangs as well, but maxAttempts is reached
+	startedAt = hangBoot(g)
+	if recovered := g.watchdog(startedAt); !recovered.Equal(startedAt) {
+		t.Errorf("watchdog recovered the instance beyond maxAttempts")
+	}
+	if n := fake.Requests(fakecompute.ActionReset); n != 1 {
+		t.Errorf("reset requests = %d, want 1", n)
+	}
+	if events := auditEvents(t, g); events[len(events)-1] != auditWatchdogFailed {
+		t.Errorf("audit events = %v, want %s last", events, auditWatchdogFailed)
+	}
+}
+
+func TestWatchdogRestart(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, func(c *Config) {
+		c.Watchdog = WatchdogConfig{Enabled: true, TimeoutMinutes: 5, Action: watchdogRestart, MaxAttempts: 1}
+	})
+
+	startedAt := startHungInstance(t, g)
+	if recovered := g.watchdog(startedAt); recovered.Equal(startedAt) {
+		t.Fatalf("watchdog did not recover the hung instance")
+	}
+	if stops, starts := fake.Requests(fakecompute.ActionStop), fake.Requests(fakecompute.ActionStart); stops != 1 || starts != 2 {
+		t.Errorf("stop, start requests = %d, %d, want 1, 2", stops, starts)
+	}
+	if status := fake.Status(testProject, testZone, testInstance); status != statusRunning {
+		t.Errorf("instance status = %s, want %s", status, statusRunning)
+	}
+}
+
+func TestWatchdogReleasesLock(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, func(c *Config) {
+		c.Watchdog = WatchdogConfig{Enabled: true, TimeoutMinutes: 5, Action: watchdogReset, MaxAttempts: 1}
+		c.Readiness.MaxAgeSeconds = 60
+	})
+
+	startedAt := startHungInstance(t, g)
+	// The background probe found the server not ready
+	g.readyCache = newReadinessCache()
+	g.readyCache.store(g.readyCache.begin(), false)
+	fake.SetDelay(fakecompute.ActionReset, 2*time.Second)
+	done := make(chan time.Time)
+	go func() { done <- g.watchdog(startedAt) }()
+	waitFor(t, "reset request", func() bool { return fake.Requests(fakecompute.ActionReset) == 1 })
+
+	// Players connecting while the reset is awaited learn about the recovery right away
+	connected := time.Now()
+	allowed, outcome := g.admitPlayer(context.Background(), g.proxy.Server(testServer),
+		trigger{Player: "alice", PlayerID: "a", Reason: "player_connect"})
+	if allowed || outcome != startRecovering {
+		t.Errorf("admitPlayer during the recovery = %v, %v, want false, %v", allowed, outcome, startRecovering)
+	}
+	if elapsed := time.Since(connected); elapsed > time.Second {
+		t.Errorf("admitPlayer took %v while the instance was recovered", elapsed)
+	}
+
+	if recovered := <-done; recovered.Equal(startedAt) {
+		t.Fatal("watchdog did not recover the hung instance")
+	}
+	if events := auditEvents(t, g); events[len(events)-1] != auditWatchdogRecovered {
+		t.Errorf("audit events = %v, want %s last", events, auditWatchdogRecovered)
+	}
+}
+
+func TestWatchdogWithinTimeout(t *testing.T) {
+	g, fake := newTestController(t, statusTerminated, func(c *Config) {
+		c.Watchdog = WatchdogConfig{Enabled: true, TimeoutMinutes: 5, Action: watchdogReset, MaxAttempts: 1}
+	})
+
+	if _, err := g.tryStartServer(context.Background(), trigger{Reason: "player_connect"}); err != nil {
+		t.Fatalf("tryStartServer: %v", err)
+	}
+	g.mu.RLock()
+	startedAt := g.bootStartedAt
+	g.mu.RUnlock()
+
+	if recovered := g.watchdog(startedAt); !recovered.Equal(startedAt) {
+		t.Errorf("watchdog recovered a boot within the timeout")
+	}
+	if n := fake.Requests(fakecompute.ActionReset); n != 0 {
+		t.Errorf("reset requests = %d, want 0", n)
+	}
+}
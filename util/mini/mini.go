@@ -8,6 +8,7 @@
 package mini
 
 import (
+	"errors"
 	"fmt"
 	"go.minekube.com/common/minecraft/color"
 	c "go.minekube.com/common/minecraft/component"
@@ -18,59 +19,94 @@ import (
 // Parse takes a string as input and returns a `c.Text` object. It splits the input string by "<",
 // then further splits each substring by ">". It modifies the style based on the key (the part before ">")
 // and appends a new text component with the modified style and content (the part after ">").
+// Tags that can't be parsed are printed and left out.
 func Parse(mini string) *c.Text {
+	text, err := parse(mini)
+	if err != nil {
+		fmt.Println(err)
+	}
+	return text
+}
+
+// Validate takes a string as input and returns an error for every tag that can't be parsed,
+// e.g. to reject bad markup in a configuration before it is shown to players.
+func Validate(mini string) error {
+	_, err := parse(mini)
+	return err
+}
+
+// parse parses the input string like Parse and returns the errors of the tags it left out
+func parse(mini string) (*c.Text, error) {
+	var errs []error
 	var styles []c.Style
 	styles = append(styles, c.Style{Color: color.White})
 
 	var components []c.Component
 
-	for _, s := range strings.Split(mini, "<") {
+	for i, s := range strings.Split(mini, "<") {
 		if s == "" {
 			continue
 		}
 
-		split := strings.Split(s, ">")
+		key, content, ok := strings.Cut(s, ">")
+		if i == 0 || !ok {
+			// Text before the first tag, or a "<" that doesn't open a tag
+			if i > 0 {
+				s = "<" + s
+			}
+			components = append(components, &c.Text{Content: s, S: styles[len(styles)-1]})
+			continue
+		}
 
-		key := split[0]
 		if strings.HasPrefix(key, "/") {
-			styles = styles[:len(styles)-1]
-		} else {
-			newStyle := styles[len(styles)-1]
-
-			styles = append(styles, newStyle)
+			// Closing tag, the content continues in the enclosing style
+			if len(styles) > 1 {
+				styles = styles[:len(styles)-1]
+			}
+			if content != "" {
+				components = append(components, &c.Text{Content: content, S: styles[len(styles)-1]})
+			}
+			continue
 		}
 
-		newText := modify(key, split[1], &styles[len(styles)-1])
-		components = append(components, newText)
+		newStyle := styles[len(styles)-1]
+		styles = append(styles, newStyle)
 
+		newText, err := modify(key, content, &styles[len(styles)-1])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("<%s>: %w", key, err))
+			continue
+		}
+		components = append(components, newText)
 	}
 
 	return &c.Text{
 		Extra: components,
-	}
+	}, errors.Join(errs...)
 }
 
 // modify takes a key, content, and style as input and returns a `c.Text` object. It modifies the style
 // based on the key and returns a new text component with the modified style and content.
-func modify(key string, content string, style *c.Style) *c.Text {
+func modify(key string, content string, style *c.Style) (*c.Text, error) {
 	newText := &c.Text{}
 
 	switch {
 	case strings.HasPrefix(key, "#"): // <#ff00ff>
 		parsed, err := ParseColor(key)
 		if err != nil {
-			fmt.Println(err)
-			return nil
+			return nil, err
 		}
 		style.Color = parsed
 		newText.Content = content
 		newText.S = *style
 	case strings.HasPrefix(key, "color"): // <color:light_purple>
-		colorName := strings.Split(key, ":")[1]
+		_, colorName, ok := strings.Cut(key, ":")
+		if !ok {
+			return nil, errors.New("missing color")
+		}
 		parsed, err := ParseColor(colorName)
 		if err != nil {
-			fmt.Println(err)
-			return nil
+			return nil, err
 		}
 		style.Color = parsed
 		newText.Content = content
@@ -84,22 +120,28 @@ func modify(key string, content string, style *c.Style) *c.Text {
 	case strings.HasPrefix(key, "gradient"): // <gradient:light_purple:gold>
 		colorKey := strings.Split(key, ":")
 		colorNames := colorKey[1:]
+		if len(colorNames) < 2 {
+			return nil, errors.New("a gradient needs at least two colors")
+		}
 
 		colors := make([]color.RGB, len(colorNames))
 		for i, col := range colorNames {
 			parsedColor, err := ParseColor(col)
 			if err != nil {
-				fmt.Println(err)
-				return nil
+				return nil, err
 			}
 			newColor, _ := color.Make(parsedColor)
 			colors[i] = *newColor
 		}
 
 		newText = Gradient(content, *style, colors...)
+
+	default: // unknown tags are ignored
+		newText.Content = content
+		newText.S = *style
 	}
 
-	return newText
+	return newText, nil
 }
 
 // ParseColor takes a string as input and returns a `color.Color` object. It checks if the input string